@@ -0,0 +1,175 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrNotSupportedInMemory = errors.New("operation is not supported by the in-memory backend")
+
+// The operations bark performs on a single collection
+// Implemented by MongoDB and by the in-memory backend used in tests
+type Backend interface {
+	Find(ctx context.Context, filter any, opts *options.FindOptionsBuilder) (Cursor, error)
+	// Returns mongo.ErrNoDocuments if nothing matches
+	FindOne(ctx context.Context, filter any, opts *options.FindOneOptionsBuilder) (bson.Raw, error)
+	CountDocuments(ctx context.Context, filter any) (int64, error)
+	InsertOne(ctx context.Context, document any) (*mongo.InsertOneResult, error)
+	InsertMany(ctx context.Context, documents []any) (*mongo.InsertManyResult, error)
+	UpdateOne(ctx context.Context, filter any, update any, opts *options.UpdateOneOptionsBuilder) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter any, update any, opts *options.UpdateManyOptionsBuilder) (*mongo.UpdateResult, error)
+	ReplaceOne(ctx context.Context, filter any, replacement any, opts *options.ReplaceOptionsBuilder) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter any) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter any) (*mongo.DeleteResult, error)
+	Aggregate(ctx context.Context, pipeline any) (Cursor, error)
+	Distinct(ctx context.Context, fieldName string, filter any) (bson.RawArray, error)
+	// Returns the name of the index
+	CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptionsBuilder) (string, error)
+	// Creates the collection explicitly, returns a NamespaceExists command error if it already exists
+	CreateCollection(ctx context.Context, opts *options.CreateCollectionOptionsBuilder) error
+	// Returns the collection's name, type and options, nil if it doesn't exist
+	Specification(ctx context.Context) (*mongo.CollectionSpecification, error)
+	// Changes the collection's options with collMod, e.g. its validator
+	ModifyCollection(ctx context.Context, changes bson.D) error
+}
+
+// Iterates over the raw documents returned by Backend.Find
+type Cursor interface {
+	Next(ctx context.Context) bool
+	Current() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Returns the backend for the collection
+// This is the in-memory backend if one is set in the context or registered for the database name,
+// otherwise it is the MongoDB collection
+// Calls on the backend run through any faults set in the context
+func (c *Collection[T]) Backend(ctx context.Context) (Backend, error) {
+	if mockError, ok := ctx.Value(MockDbErrorKey).(string); ok {
+		return nil, errors.New(mockError)
+	}
+	if memory := memoryDbFrom(ctx); memory != nil {
+		if c.Name == "" {
+			return nil, fmt.Errorf("collection name is required")
+		}
+		return intercept(memory.Collection(c.Name), c.Name, ctx), nil
+	}
+	collection, err := c.MongoCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return intercept(&mongoBackend{collection: collection}, c.Name, ctx), nil
+}
+
+// Backend that runs operations against a MongoDB collection
+type mongoBackend struct {
+	collection *mongo.Collection
+}
+
+func (b *mongoBackend) Find(ctx context.Context, filter any, opts *options.FindOptionsBuilder) (Cursor, error) {
+	cursor, err := b.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoCursor{cursor: cursor}, nil
+}
+
+func (b *mongoBackend) FindOne(ctx context.Context, filter any, opts *options.FindOneOptionsBuilder) (bson.Raw, error) {
+	return b.collection.FindOne(ctx, filter, opts).Raw()
+}
+
+func (b *mongoBackend) CountDocuments(ctx context.Context, filter any) (int64, error) {
+	return b.collection.CountDocuments(ctx, filter)
+}
+
+func (b *mongoBackend) InsertOne(ctx context.Context, document any) (*mongo.InsertOneResult, error) {
+	return b.collection.InsertOne(ctx, document)
+}
+
+func (b *mongoBackend) InsertMany(ctx context.Context, documents []any) (*mongo.InsertManyResult, error) {
+	return b.collection.InsertMany(ctx, documents)
+}
+
+func (b *mongoBackend) UpdateOne(ctx context.Context, filter any, update any, opts *options.UpdateOneOptionsBuilder) (*mongo.UpdateResult, error) {
+	return b.collection.UpdateOne(ctx, filter, update, opts)
+}
+
+func (b *mongoBackend) UpdateMany(ctx context.Context, filter any, update any, opts *options.UpdateManyOptionsBuilder) (*mongo.UpdateResult, error) {
+	return b.collection.UpdateMany(ctx, filter, update, opts)
+}
+
+func (b *mongoBackend) ReplaceOne(ctx context.Context, filter any, replacement any, opts *options.ReplaceOptionsBuilder) (*mongo.UpdateResult, error) {
+	return b.collection.ReplaceOne(ctx, filter, replacement, opts)
+}
+
+func (b *mongoBackend) DeleteOne(ctx context.Context, filter any) (*mongo.DeleteResult, error) {
+	return b.collection.DeleteOne(ctx, filter)
+}
+
+func (b *mongoBackend) DeleteMany(ctx context.Context, filter any) (*mongo.DeleteResult, error) {
+	return b.collection.DeleteMany(ctx, filter)
+}
+
+func (b *mongoBackend) Aggregate(ctx context.Context, pipeline any) (Cursor, error) {
+	cursor, err := b.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoCursor{cursor: cursor}, nil
+}
+
+func (b *mongoBackend) Distinct(ctx context.Context, fieldName string, filter any) (bson.RawArray, error) {
+	return b.collection.Distinct(ctx, fieldName, filter).Raw()
+}
+
+func (b *mongoBackend) CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptionsBuilder) (string, error) {
+	return b.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts})
+}
+
+func (b *mongoBackend) CreateCollection(ctx context.Context, opts *options.CreateCollectionOptionsBuilder) error {
+	return b.collection.Database().CreateCollection(ctx, b.collection.Name(), opts)
+}
+
+func (b *mongoBackend) Specification(ctx context.Context) (*mongo.CollectionSpecification, error) {
+	specs, err := b.collection.Database().ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: b.collection.Name()}})
+	if err != nil || len(specs) == 0 {
+		return nil, err
+	}
+	return &specs[0], nil
+}
+
+func (b *mongoBackend) ModifyCollection(ctx context.Context, changes bson.D) error {
+	command := append(bson.D{{Key: "collMod", Value: b.collection.Name()}}, changes...)
+	return b.collection.Database().RunCommand(ctx, command).Err()
+}
+
+// Adapts a driver cursor to the Cursor interface
+type mongoCursor struct {
+	cursor *mongo.Cursor
+}
+
+func (c *mongoCursor) Next(ctx context.Context) bool   { return c.cursor.Next(ctx) }
+func (c *mongoCursor) Current() bson.Raw               { return c.cursor.Current }
+func (c *mongoCursor) Err() error                      { return c.cursor.Err() }
+func (c *mongoCursor) Close(ctx context.Context) error { return c.cursor.Close(ctx) }
+
+// Collects the options set on an options builder, a nil builder gives the zero options
+func resolveOptions[T any](lister options.Lister[T]) (*T, error) {
+	opts := new(T)
+	if lister == nil || reflect.ValueOf(lister).IsNil() {
+		return opts, nil
+	}
+	for _, set := range lister.List() {
+		if err := set(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
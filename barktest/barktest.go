@@ -0,0 +1,42 @@
+// Package barktest provides helpers for tests that use bark
+package barktest
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+)
+
+// MongoDB limits database names to 64 bytes
+const maxDbNameLength = 63
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Returns a context that uses a new, uniquely named test database
+// The context's clock is frozen at the current time, rounded to the millisecond MongoDB stores
+// The database is dropped when the test finishes
+func NewDB(t testing.TB) context.Context {
+	t.Helper()
+	name := dbName(t.Name())
+	ctx := context.WithValue(context.Background(), bark.DbNameKey, name)
+	ctx = bark.WithClock(ctx, bark.FixedClock(time.Now().UTC().Truncate(time.Millisecond)))
+	t.Cleanup(func() {
+		if err := bark.DropDatabase(ctx); err != nil {
+			t.Errorf("failed to drop test database %s: %v", name, err)
+		}
+	})
+	return ctx
+}
+
+// Returns a unique database name starting with "test-" for the test
+func dbName(testName string) string {
+	suffix := "-" + bark.ObjectIDHex().NewID()
+	name := "test-" + unsafeChars.ReplaceAllString(testName, "_")
+	if len(name)+len(suffix) > maxDbNameLength {
+		name = name[:maxDbNameLength-len(suffix)]
+	}
+	return name + suffix
+}
@@ -0,0 +1,27 @@
+package barktest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDbName(t *testing.T) {
+	t.Run("Is unique and starts with test", func(t *testing.T) {
+		first, second := dbName(t.Name()), dbName(t.Name())
+		if first == second {
+			t.Errorf("Expected unique names, got %s twice", first)
+		}
+		if !strings.HasPrefix(first, "test-TestDbName_Is_unique") {
+			t.Errorf("Expected name to start with the sanitized test name, got %s", first)
+		}
+	})
+	t.Run("Fits MongoDB's limit", func(t *testing.T) {
+		name := dbName(strings.Repeat("a/b.c ", 30))
+		if len(name) > maxDbNameLength {
+			t.Errorf("Expected at most %d characters, got %d", maxDbNameLength, len(name))
+		}
+		if strings.ContainsAny(name, "/. ") {
+			t.Errorf("Expected unsafe characters to be replaced, got %s", name)
+		}
+	})
+}
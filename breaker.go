@@ -0,0 +1,241 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// The state of a circuit breaker
+type CircuitState int
+
+const (
+	// Calls go through and their failures are counted
+	CircuitClosed CircuitState = iota
+	// Calls fail fast with ErrCircuitOpen
+	CircuitOpen
+	// A few trial calls go through to see if the database has recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// Settings for a circuit breaker, zero fields use the defaults
+type BreakerSettings struct {
+	// How far back failures are counted, defaults to 10s
+	Window time.Duration
+	// Calls needed in the window before the breaker can open, defaults to 10
+	MinRequests int
+	// Fraction of failed calls in the window that opens the breaker, defaults to 0.5
+	FailureRate float64
+	// How long the breaker stays open before letting trial calls through, defaults to 30s
+	OpenFor time.Duration
+	// Trial calls that must succeed to close the breaker again, defaults to 1
+	HalfOpenRequests int
+	// Tells the time, defaults to the real clock
+	Clock Clock
+}
+
+// The number of buckets the window is split into
+const breakerBuckets = 10
+
+// Stops calls to a database while it is failing
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	settings  BreakerSettings
+	state     CircuitState
+	openedAt  time.Time
+	buckets   [breakerBuckets]breakerBucket
+	trials    int
+	successes int
+}
+
+// The calls and failures in one slice of the window
+type breakerBucket struct {
+	slot     int64
+	calls    int
+	failures int
+}
+
+// Creates a closed circuit breaker
+func NewCircuitBreaker(settings BreakerSettings) *CircuitBreaker {
+	if settings.Window <= 0 {
+		settings.Window = 10 * time.Second
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = 10
+	}
+	if settings.FailureRate <= 0 {
+		settings.FailureRate = 0.5
+	}
+	if settings.OpenFor <= 0 {
+		settings.OpenFor = 30 * time.Second
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+	if settings.Clock == nil {
+		settings.Clock = RealClock()
+	}
+	return &CircuitBreaker{settings: settings}
+}
+
+// Breakers by database name, kept alongside the dbs connection registry
+var breakersMu sync.RWMutex
+var breakers = make(map[string]*CircuitBreaker)
+
+// Puts a circuit breaker in front of the named database and returns it
+func EnableCircuitBreaker(dbName string, settings BreakerSettings) *CircuitBreaker {
+	breaker := NewCircuitBreaker(settings)
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	breakers[dbName] = breaker
+	return breaker
+}
+
+// Removes the circuit breaker from the named database
+func DisableCircuitBreaker(dbName string) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	delete(breakers, dbName)
+}
+
+// Returns the circuit breaker for the named database, or nil if it doesn't have one
+func CircuitBreakerFor(dbName string) *CircuitBreaker {
+	breakersMu.RLock()
+	defer breakersMu.RUnlock()
+	return breakers[dbName]
+}
+
+// Returns the state of every circuit breaker by database name, for health checks
+func CircuitStates() map[string]CircuitState {
+	breakersMu.RLock()
+	defer breakersMu.RUnlock()
+	states := make(map[string]CircuitState, len(breakers))
+	for name, breaker := range breakers {
+		states[name] = breaker.State()
+	}
+	return states
+}
+
+// Returns the current state of the breaker
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkCooldown()
+	return b.state
+}
+
+// Moves an open breaker to half-open once it has been open long enough, the caller must hold the lock
+func (b *CircuitBreaker) checkCooldown() {
+	if b.state == CircuitOpen && b.settings.Clock.Now().Sub(b.openedAt) >= b.settings.OpenFor {
+		b.state = CircuitHalfOpen
+		b.trials = 0
+		b.successes = 0
+	}
+}
+
+// Returns ErrCircuitOpen if a call shouldn't go through, otherwise the call must be reported with done
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkCooldown()
+	switch b.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.trials >= b.settings.HalfOpenRequests {
+			return ErrCircuitOpen
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// Records the outcome of a call let through by allow
+func (b *CircuitBreaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.settings.Clock.Now()
+	switch b.state {
+	case CircuitHalfOpen:
+		if failed {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenRequests {
+			b.state = CircuitClosed
+			b.buckets = [breakerBuckets]breakerBucket{}
+		}
+	case CircuitClosed:
+		width := b.settings.Window / breakerBuckets
+		slot := now.UnixNano() / int64(width)
+		bucket := &b.buckets[slot%breakerBuckets]
+		if bucket.slot != slot {
+			*bucket = breakerBucket{slot: slot}
+		}
+		bucket.calls++
+		if failed {
+			bucket.failures++
+		}
+		calls, failures := 0, 0
+		for _, bucket := range b.buckets {
+			if slot-bucket.slot < breakerBuckets {
+				calls += bucket.calls
+				failures += bucket.failures
+			}
+		}
+		if calls >= b.settings.MinRequests && float64(failures)/float64(calls) >= b.settings.FailureRate {
+			b.open(now)
+		}
+	}
+}
+
+// Opens the breaker, the caller must hold the lock
+func (b *CircuitBreaker) open(now time.Time) {
+	b.state = CircuitOpen
+	b.openedAt = now
+	b.buckets = [breakerBuckets]breakerBucket{}
+}
+
+// Returns true if the error means the database is unhealthy rather than the call being wrong
+func isDatabaseFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) && writeErr.WriteConcernError != nil {
+		return true
+	}
+	return mongo.IsNetworkError(err) || mongo.IsTimeout(err) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		hasErrorLabel(err, "RetryableWriteError") || hasErrorLabel(err, transientTransactionError)
+}
+
+// Fails the call fast while the breaker is open and records its outcome otherwise
+func (b *CircuitBreaker) intercept(ctx context.Context, op *Operation, next func(ctx context.Context) error) error {
+	if err := b.allow(); err != nil {
+		return fmt.Errorf("%w: %s", err, op.Database)
+	}
+	err := next(ctx)
+	b.done(isDatabaseFailure(err))
+	return err
+}
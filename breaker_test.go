@@ -0,0 +1,86 @@
+package bark_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := setupMemoryTest("CircuitBreaker", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	clock := bark.NewManualClock(time.Date(2024, 3, 27, 19, 55, 38, 0, time.UTC))
+	breaker := bark.EnableCircuitBreaker("test-CircuitBreaker", bark.BreakerSettings{
+		Window:      10 * time.Second,
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenFor:     30 * time.Second,
+		Clock:       clock,
+	})
+	defer bark.DisableCircuitBreaker("test-CircuitBreaker")
+	failing := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Err: bark.TransientError()}))
+
+	t.Run("Ignores errors that aren't the database's fault", func(t *testing.T) {
+		notFound := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Err: bark.DuplicateKeyError()}))
+		for i := 0; i < 4; i++ {
+			dogs.Count(bson.M{}, notFound)
+		}
+		if breaker.State() != bark.CircuitClosed {
+			t.Errorf("Expected the breaker to stay closed, got %s", breaker.State())
+		}
+	})
+	t.Run("Opens when the failure rate is reached", func(t *testing.T) {
+		clock.Advance(time.Minute)
+		dogs.Count(bson.M{}, ctx)
+		dogs.Count(bson.M{}, failing)
+		if breaker.State() != bark.CircuitClosed {
+			t.Errorf("Expected the breaker to wait for MinRequests, got %s", breaker.State())
+		}
+		dogs.Count(bson.M{}, ctx)
+		dogs.Count(bson.M{}, failing)
+		if breaker.State() != bark.CircuitOpen {
+			t.Errorf("Expected the breaker to open, got %s", breaker.State())
+		}
+		if states := bark.CircuitStates(); states["test-CircuitBreaker"] != bark.CircuitOpen {
+			t.Errorf("Expected the open state to be reported, got %v", states)
+		}
+	})
+	t.Run("Fails fast while open", func(t *testing.T) {
+		faults := bark.NewFaults()
+		_, err := dogs.Get("1111", bark.WithFaults(ctx, faults))
+		if !errors.Is(err, bark.ErrCircuitOpen) {
+			t.Errorf("Expected ErrCircuitOpen, got %v", err)
+		}
+		if faults.Calls("", "") != 0 {
+			t.Errorf("Expected the call not to reach the backend")
+		}
+		if _, err := bark.Db(ctx); !errors.Is(err, bark.ErrCircuitOpen) {
+			t.Errorf("Expected Db to fail fast, got %v", err)
+		}
+	})
+	t.Run("Reopens when the trial call fails", func(t *testing.T) {
+		clock.Advance(30 * time.Second)
+		if breaker.State() != bark.CircuitHalfOpen {
+			t.Fatalf("Expected the breaker to be half-open, got %s", breaker.State())
+		}
+		dogs.Count(bson.M{}, failing)
+		if breaker.State() != bark.CircuitOpen {
+			t.Errorf("Expected the breaker to open again, got %s", breaker.State())
+		}
+	})
+	t.Run("Closes when the trial call succeeds", func(t *testing.T) {
+		clock.Advance(30 * time.Second)
+		if _, err := dogs.Get("1111", ctx); err != nil {
+			t.Fatalf("Expected the trial call to succeed, got %v", err)
+		}
+		if breaker.State() != bark.CircuitClosed {
+			t.Errorf("Expected the breaker to close, got %s", breaker.State())
+		}
+	})
+}
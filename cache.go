@@ -0,0 +1,271 @@
+package bark
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/sync/singleflight"
+)
+
+// Stores raw documents for Collection.Get and FindOne
+// Implementations must be safe to use from several goroutines
+type Cache interface {
+	// Returns the value stored under the key, if it is there and hasn't expired
+	Get(key string) ([]byte, bool)
+	// Stores the value under the key, a ttl of 0 means it doesn't expire
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// Counts how a collection's cache has been used
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+}
+
+// The cache of a collection with its stats
+// Keys include a generation that every write bumps, so a write makes all cached lookups stale at once
+type collectionCache struct {
+	cache         Cache
+	ttl           time.Duration
+	generation    atomic.Uint64
+	group         singleflight.Group
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// Caches the results of Get and FindOne on the collection for up to ttl, 0 for no limit
+// The cache is invalidated by writes made through bark to the collection, including SaveModel and Delete
+// Writes made outside bark aren't seen, so use a ttl if other processes write to the collection
+func (c *Collection[T]) EnableCache(cache Cache, ttl time.Duration) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.cache = &collectionCache{cache: cache, ttl: ttl}
+	return c
+}
+
+// Stops caching lookups on the collection
+func (c *Collection[T]) DisableCache() *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.cache = nil
+	return c
+}
+
+// Returns the stats for the collection's cache
+func (c *Collection[T]) CacheStats() CacheStats {
+	cache := configFor(c.Name).currentCache()
+	if cache == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:          cache.hits.Load(),
+		Misses:        cache.misses.Load(),
+		Invalidations: cache.invalidations.Load(),
+	}
+}
+
+// Returns the collection's cache, or nil if caching is off
+func (cfg *collectionConfig) currentCache() *collectionCache {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.cache
+}
+
+// Invalidates every collection's cache
+// Used after transactions, whose writes only become visible to other reads when they commit
+func invalidateCaches() {
+	configsMu.Lock()
+	defer configsMu.Unlock()
+	for _, cfg := range configs {
+		if cache := cfg.currentCache(); cache != nil {
+			cache.invalidate()
+		}
+	}
+}
+
+// Makes every cached lookup stale
+func (cc *collectionCache) invalidate() {
+	cc.generation.Add(1)
+	cc.invalidations.Add(1)
+}
+
+// Invalidates the cache after every write
+func (cc *collectionCache) intercept(ctx context.Context, op *Operation, next func(ctx context.Context) error) error {
+	err := next(ctx)
+	if classOf(op.Name) != ReadOperation {
+		cc.invalidate()
+	}
+	return err
+}
+
+// Returns the cached document for the lookup, or loads it once however many callers ask at the same time
+// The shared fetch runs without the first caller's deadline or cancellation, so the read timeout applies to it,
+// and each caller stops waiting when its own context is done
+func (cc *collectionCache) load(collection string, filter bson.M, ctx context.Context, fetch func(ctx context.Context) (bson.Raw, error)) (bson.Raw, error) {
+	database, _ := ctx.Value(DbNameKey).(string)
+	if memory := memoryDbFrom(ctx); memory != nil {
+		database = "memory:" + strconv.FormatUint(memory.id, 10)
+	}
+	canonical, err := bson.MarshalExtJSON(bson.D{{Key: "filter", Value: canonicalFilter(filter)}}, true, false)
+	if err != nil {
+		return fetch(ctx)
+	}
+	key := database + "/" + collection + "/" + strconv.FormatUint(cc.generation.Load(), 10) + "/" + string(canonical)
+	if data, ok := cc.cache.Get(key); ok {
+		cc.hits.Add(1)
+		return bson.Raw(data), nil
+	}
+	cc.misses.Add(1)
+	shared := context.WithoutCancel(ctx)
+	results := cc.group.DoChan(key, func() (any, error) {
+		raw, err := fetch(shared)
+		if err != nil {
+			return nil, err
+		}
+		cc.cache.Set(key, raw, cc.ttl)
+		return raw, nil
+	})
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(bson.Raw), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Returns the filter with the keys of its maps sorted, so equal filters give equal cache keys
+func canonicalFilter(value any) any {
+	switch value := value.(type) {
+	case bson.M:
+		return canonicalFilter(map[string]any(value))
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		doc := make(bson.D, len(keys))
+		for i, k := range keys {
+			doc[i] = bson.E{Key: k, Value: canonicalFilter(value[k])}
+		}
+		return doc
+	case bson.D:
+		doc := make(bson.D, len(value))
+		for i, e := range value {
+			doc[i] = bson.E{Key: e.Key, Value: canonicalFilter(e.Value)}
+		}
+		return doc
+	case bson.A:
+		return canonicalFilter([]any(value))
+	case []any:
+		out := make(bson.A, len(value))
+		for i, v := range value {
+			out[i] = canonicalFilter(v)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// An in-process cache that evicts the least recently used entries once it is full
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	clock    Clock
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+// An entry in the LRU cache
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Creates an LRU cache holding up to capacity entries, 1000 if capacity isn't positive
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &LRUCache{capacity: capacity, clock: RealClock(), entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Sets the clock used to expire entries
+func (c *LRUCache) WithClock(clock Clock) *LRUCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+	return c
+}
+
+// Returns the value stored under the key, if it is there and hasn't expired
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.clock.Now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Stores the value under the key, evicting the least recently used entry if the cache is full
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.clock.Now().Add(ttl)
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = &lruEntry{key: key, value: value, expires: expires}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Removes the value stored under the key
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Returns the number of entries in the cache, including expired ones not yet removed
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
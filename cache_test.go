@@ -0,0 +1,157 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCollectionCache(t *testing.T) {
+	ctx := setupMemoryTest("CollectionCache", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}, {Name: "Spot", Id: "2222", Age: 5}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	dogs.EnableCache(bark.NewLRUCache(100), time.Minute)
+	defer dogs.DisableCache()
+	faults := bark.NewFaults()
+	ctx = bark.WithFaults(ctx, faults)
+
+	t.Run("Serves repeated lookups from the cache", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			dog, err := dogs.Get("1111", ctx)
+			if err != nil || dog.Name != "Fido" {
+				t.Fatalf("Expected Fido, got %v and %v", dog, err)
+			}
+		}
+		if _, err := dogs.FindOne(bson.M{"Age": 5, "Name": "Spot"}, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := dogs.FindOne(bson.M{"Name": "Spot", "Age": 5}, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if calls := faults.Calls(DogCollectionName, "FindOne"); calls != 2 {
+			t.Errorf("Expected 2 database lookups, got %d", calls)
+		}
+		if stats := dogs.CacheStats(); stats.Hits != 3 || stats.Misses != 2 {
+			t.Errorf("Expected 3 hits and 2 misses, got %+v", stats)
+		}
+	})
+	t.Run("Saving a model invalidates the cache", func(t *testing.T) {
+		fido, _ := dogs.Get("1111", ctx)
+		fido.Age = 4
+		if _, err := fido.Save(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		fido, _ = dogs.Get("1111", ctx)
+		if fido.Age != 4 {
+			t.Errorf("Expected the saved age, got %d", fido.Age)
+		}
+	})
+	t.Run("Deleting invalidates the cache", func(t *testing.T) {
+		dogs.Get("2222", ctx)
+		if _, err := dogs.DeleteOne(bson.M{"Id": "2222"}, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := dogs.Get("2222", ctx); err != bark.ErrNotFound {
+			t.Errorf("Expected ErrNotFound after delete, got %v", err)
+		}
+	})
+	t.Run("Concurrent misses load once", func(t *testing.T) {
+		// Any write invalidates the cache, so every goroutine starts with a miss
+		dogs.DeleteMany(bson.M{"Id": "none"}, ctx)
+		slow := bark.NewFaults(bark.Fault{Operation: "FindOne", Delay: 20 * time.Millisecond})
+		slowCtx := bark.WithFaults(ctx, slow)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dogs.Get("1111", slowCtx)
+			}()
+		}
+		wg.Wait()
+		if calls := slow.Calls(DogCollectionName, "FindOne"); calls != 1 {
+			t.Errorf("Expected 1 database lookup, got %d", calls)
+		}
+	})
+	t.Run("A cancelled caller doesn't fail the others", func(t *testing.T) {
+		dogs.DeleteMany(bson.M{"Id": "none"}, ctx)
+		slow := bark.NewFaults(bark.Fault{Operation: "FindOne", Delay: 50 * time.Millisecond})
+		slowCtx := bark.WithFaults(ctx, slow)
+		cancelCtx, cancel := context.WithCancel(slowCtx)
+		cancelled := make(chan error, 1)
+		go func() {
+			_, err := dogs.Get("1111", cancelCtx)
+			cancelled <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		waiting := make(chan error, 1)
+		go func() {
+			_, err := dogs.Get("1111", slowCtx)
+			waiting <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		if err := <-cancelled; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the cancelled caller to stop with its own error, got %v", err)
+		}
+		if err := <-waiting; err != nil {
+			t.Errorf("Expected the other caller to get the dog, got %v", err)
+		}
+		if calls := slow.Calls(DogCollectionName, "FindOne"); calls != 1 {
+			t.Errorf("Expected 1 database lookup, got %d", calls)
+		}
+	})
+	t.Run("Memory databases with the same name don't share entries", func(t *testing.T) {
+		otherCtx := bark.WithMemoryDb(ctx, bark.NewMemoryDb())
+		rex := NewDog("Rex")
+		rex.Id = "1111"
+		if _, err := rex.Save(otherCtx); err != nil {
+			t.Fatalf("Failed to save Rex: %v", err)
+		}
+		if dog, err := dogs.Get("1111", ctx); err != nil || dog.Name != "Fido" {
+			t.Fatalf("Expected Fido, got %v and %v", dog, err)
+		}
+		if dog, err := dogs.Get("1111", otherCtx); err != nil || dog.Name != "Rex" {
+			t.Errorf("Expected Rex from the other database, got %v and %v", dog, err)
+		}
+	})
+	t.Run("Transactions skip the cache", func(t *testing.T) {
+		before := faults.Calls(DogCollectionName, "FindOne")
+		bark.WithTransaction(ctx, func(txCtx context.Context) error {
+			_, err := dogs.Get("1111", txCtx)
+			return err
+		})
+		if faults.Calls(DogCollectionName, "FindOne") != before+1 {
+			t.Errorf("Expected the lookup to reach the database")
+		}
+	})
+}
+func TestLRUCache(t *testing.T) {
+	clock := bark.NewManualClock(time.Date(2024, 3, 27, 19, 55, 38, 0, time.UTC))
+	cache := bark.NewLRUCache(2).WithClock(clock)
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), time.Minute)
+	cache.Get("a")
+	cache.Set("c", []byte("3"), 0)
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	if value, ok := cache.Get("a"); !ok || string(value) != "1" {
+		t.Errorf("Expected a to be kept, got %s", value)
+	}
+	cache.Set("d", []byte("4"), time.Minute)
+	clock.Advance(time.Minute)
+	if _, ok := cache.Get("d"); ok {
+		t.Errorf("Expected d to expire")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 entry left, got %d", cache.Len())
+	}
+}
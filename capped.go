@@ -0,0 +1,219 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrTailPositionLost = errors.New("the document the tail resumes after is no longer in the capped collection")
+
+// The error code MongoDB gives when a tailable cursor's position was overwritten
+const cappedPositionLost = 136
+
+// The limits of a capped collection
+type capped struct {
+	size int64
+	max  int64
+}
+
+// Returns the collection's capped limits, nil if it isn't capped
+func (cfg *collectionConfig) currentCapped() *capped {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.capped
+}
+
+// Creates the collection as a capped collection of at most size bytes and, unless max is 0, max documents
+// Once full the oldest documents are removed to make room, which makes it a fixed size log that can be tailed
+// Does nothing if the collection already exists
+// Documents should be added with InsertMany or SaveModel and not grow when updated
+func (c *Collection[T]) CreateCapped(size int64, max int64, ctx context.Context) error {
+	if size <= 0 {
+		return fmt.Errorf("capped collection size must be positive, got %d", size)
+	}
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	cfg.capped = &capped{size: size, max: max}
+	cfg.mu.Unlock()
+	return c.EnsureCollection(ctx)
+}
+
+// Options for Collection.Tail
+type TailOptions struct {
+	// Starts after the document with this Id, "" to start from the oldest document
+	After string
+	// How long the server waits for new documents before answering an empty batch, 0 for the server default
+	MaxAwait time.Duration
+	// How long to wait before reopening a cursor that closed, e.g. because the collection was empty, 0 for 100ms
+	RetryInterval time.Duration
+	// Maximum number of documents to fetch per batch, 0 for the server default
+	BatchSize int32
+}
+
+// A typed iterator over the documents of a capped collection that waits for new ones as they are inserted
+type TailCursor[T ModelWithCollection] struct {
+	collection *Collection[T]
+	backend    Backend
+	filter     bson.M
+	opts       TailOptions
+	cursor     Cursor
+	// The Id of the last document returned, reopened cursors skip up to it
+	lastId   string
+	skipping bool
+	current  T
+	err      error
+}
+
+// Opens a tailable cursor on the capped collection that returns the documents matching the filter in insertion order,
+// then waits for new ones
+// Keep the Id of the last document handled, see TailCursor.LastId, and pass it as TailOptions.After to resume later
+func (c *Collection[T]) Tail(filter bson.M, opts *TailOptions, ctx context.Context) (*TailCursor[T], error) {
+	if opts == nil {
+		opts = &TailOptions{}
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 100 * time.Millisecond
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to tail: %w", err)
+	}
+	tail := &TailCursor[T]{collection: c, backend: backend, filter: filter, opts: *opts, lastId: opts.After}
+	if err := tail.open(ctx); err != nil {
+		return nil, err
+	}
+	return tail, nil
+}
+
+// Opens the cursor, positioned after the last document returned
+func (t *TailCursor[T]) open(ctx context.Context) error {
+	filter := t.filter
+	if t.lastId != "" {
+		// The last document is fetched even if it no longer matches the filter so the cursor can skip up to it
+		filter = bson.M{"$or": bson.A{bson.M{"Id": t.lastId}, t.filter}}
+	}
+	findOpts := options.Find().SetCursorType(options.TailableAwait)
+	if t.opts.MaxAwait > 0 {
+		findOpts.SetMaxAwaitTime(t.opts.MaxAwait)
+	}
+	if t.opts.BatchSize > 0 {
+		findOpts.SetBatchSize(t.opts.BatchSize)
+	}
+	cursor, err := t.backend.Find(ctx, filter, findOpts)
+	if err != nil {
+		return fmt.Errorf("error opening tailable cursor: %w", err)
+	}
+	if t.lastId != "" {
+		// Checked once the cursor is open: the oldest documents are removed first, so if the last document is still there
+		// the cursor starts at or before it, and removing it later also removes the cursor's position, which the server reports
+		// Otherwise the cursor would start after it and skip every document looking for it
+		if _, err := t.backend.FindOne(ctx, bson.M{"Id": t.lastId}, nil); err != nil {
+			cursor.Close(ctx)
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("%w: %s", ErrTailPositionLost, t.lastId)
+			}
+			return fmt.Errorf("error finding the document to resume after: %w", err)
+		}
+	}
+	t.cursor = cursor
+	t.skipping = t.lastId != ""
+	return nil
+}
+
+// Waits for the next document and returns true once it is available from Doc
+// Cursors the server closes are reopened after the last document, so Next only returns false
+// when the context is done or the position was lost
+func (t *TailCursor[T]) Next(ctx context.Context) bool {
+	for t.err == nil {
+		if t.cursor == nil {
+			if err := t.open(ctx); err != nil {
+				t.err = err
+				return false
+			}
+		}
+		if t.cursor.Next(ctx) {
+			if t.skip() {
+				continue
+			}
+			var obj T
+			if err := t.collection.decode(t.backend, t.cursor.Current(), &obj, ctx); err != nil {
+				t.err = fmt.Errorf("error decoding document: %w", err)
+				return false
+			}
+			obj.SetCollectionName(t.collection.Name)
+			t.current = obj
+			t.lastId = modelId(obj)
+			return true
+		}
+		err := t.cursor.Err()
+		t.cursor.Close(ctx)
+		t.cursor = nil
+		var cmdErr mongo.CommandError
+		switch {
+		case ctx.Err() != nil:
+			t.err = ctx.Err()
+		case errors.As(err, &cmdErr) && cmdErr.Code == cappedPositionLost:
+			// Reopening reports whether the last document is gone
+		case err != nil:
+			t.err = fmt.Errorf("error tailing: %w", err)
+		default:
+			// A tailable cursor is closed when it runs out of documents without ever returning one, e.g. on an empty collection
+			select {
+			case <-ctx.Done():
+				t.err = ctx.Err()
+			case <-time.After(t.opts.RetryInterval):
+			}
+		}
+	}
+	return false
+}
+
+// Returns true while the cursor is still skipping up to the document it resumes after
+func (t *TailCursor[T]) skip() bool {
+	if !t.skipping {
+		return false
+	}
+	if id, err := t.cursor.Current().LookupErr("Id"); err == nil {
+		if value, ok := id.StringValueOK(); ok && value == t.lastId {
+			t.skipping = false
+		}
+	}
+	return true
+}
+
+// Returns the current document
+func (t *TailCursor[T]) Doc() T {
+	return t.current
+}
+
+// Returns the Id of the last document returned, or the Id the cursor resumed after
+func (t *TailCursor[T]) LastId() string {
+	return t.lastId
+}
+
+// Returns the error that stopped the cursor, if any
+func (t *TailCursor[T]) Err() error {
+	return t.err
+}
+
+// Closes the cursor
+func (t *TailCursor[T]) Close(ctx context.Context) error {
+	if t.cursor == nil {
+		return nil
+	}
+	err := t.cursor.Close(ctx)
+	t.cursor = nil
+	if err != nil {
+		return fmt.Errorf("error closing tailable cursor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Activity struct {
+	bark.Model `bson:",inline"`
+	Kind       string `bson:"Kind"`
+}
+
+func activity(id string, kind string) *Activity {
+	return &Activity{Model: bark.NewModel("activities", id), Kind: kind}
+}
+
+func TestCapped(t *testing.T) {
+	db := bark.NewMemoryDb()
+	ctx := bark.WithMemoryDb(setupTest("Capped", "2024-03-27T19:55:38.782Z", t), db)
+	activities := bark.NewCollection[*Activity]("activities")
+	next := func(tail *bark.TailCursor[*Activity], ctx context.Context) string {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if !tail.Next(ctx) {
+			t.Fatalf("Expected a document, got %v", tail.Err())
+		}
+		return tail.Doc().Id
+	}
+
+	t.Run("Creates a capped collection", func(t *testing.T) {
+		if err := activities.CreateCapped(1<<20, 3, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		opts := db.CollectionOptions("activities")
+		if opts == nil || opts.Capped == nil || !*opts.Capped || *opts.SizeInBytes != 1<<20 || *opts.MaxDocuments != 3 {
+			t.Fatalf("Expected a capped collection of 3 documents, got %+v", opts)
+		}
+		if err := activities.CreateCapped(1<<20, 3, ctx); err != nil {
+			t.Errorf("Expected no error when the collection exists, got %v", err)
+		}
+		if err := activities.CreateCapped(0, 3, ctx); err == nil {
+			t.Error("Expected an error for a size of 0")
+		}
+	})
+	t.Run("Tails documents as they are inserted", func(t *testing.T) {
+		tail, err := activities.Tail(nil, &bark.TailOptions{RetryInterval: 10 * time.Millisecond}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer tail.Close(ctx)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			activities.InsertMany([]*Activity{activity("a1", "login"), activity("a2", "post")}, ctx)
+		}()
+		if id := next(tail, ctx); id != "a1" {
+			t.Errorf("Expected a1, got %s", id)
+		}
+		if id := next(tail, ctx); id != "a2" || tail.Doc().Kind != "post" || tail.LastId() != "a2" {
+			t.Errorf("Expected the post a2, got %+v", tail.Doc())
+		}
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			activities.InsertMany([]*Activity{activity("a3", "login")}, ctx)
+		}()
+		if id := next(tail, ctx); id != "a3" {
+			t.Errorf("Expected a3, got %s", id)
+		}
+	})
+	t.Run("Filters and resumes after an id", func(t *testing.T) {
+		tail, err := activities.Tail(bson.M{"Kind": "login"}, &bark.TailOptions{After: "a1"}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer tail.Close(ctx)
+		if id := next(tail, ctx); id != "a3" {
+			t.Errorf("Expected the login after a1 to be a3, got %s", id)
+		}
+		waiting, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if tail.Next(waiting) || !errors.Is(tail.Err(), context.DeadlineExceeded) {
+			t.Errorf("Expected to wait until the deadline, got %v", tail.Err())
+		}
+	})
+	t.Run("Removes the oldest documents", func(t *testing.T) {
+		if _, err := activities.InsertMany([]*Activity{activity("a4", "logout")}, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if count, _ := activities.Count(bson.M{}, ctx); count != 3 {
+			t.Errorf("Expected 3 documents, got %d", count)
+		}
+		if exists, _ := activities.ExistsById("a1", ctx); exists {
+			t.Error("Expected a1 to be removed")
+		}
+		if _, err := activities.Tail(nil, &bark.TailOptions{After: "a1"}, ctx); !errors.Is(err, bark.ErrTailPositionLost) {
+			t.Errorf("Expected ErrTailPositionLost, got %v", err)
+		}
+	})
+	t.Run("Reports a lost position", func(t *testing.T) {
+		tail, err := activities.Tail(nil, &bark.TailOptions{After: "a2"}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer tail.Close(ctx)
+		if id := next(tail, ctx); id != "a3" {
+			t.Errorf("Expected a3, got %s", id)
+		}
+		activities.InsertMany([]*Activity{activity("a5", "post"), activity("a6", "post"), activity("a7", "post")}, ctx)
+		if tail.Next(ctx) || !errors.Is(tail.Err(), bark.ErrTailPositionLost) {
+			t.Errorf("Expected ErrTailPositionLost once a3 is removed, got %v", tail.Err())
+		}
+	})
+	t.Run("Reports a position lost before it is reached", func(t *testing.T) {
+		tail, err := activities.Tail(bson.M{"Kind": "post"}, &bark.TailOptions{After: "a6"}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer tail.Close(ctx)
+		activities.InsertMany([]*Activity{activity("a8", "post"), activity("a9", "post")}, ctx)
+		waiting, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if tail.Next(waiting) || !errors.Is(tail.Err(), bark.ErrTailPositionLost) {
+			t.Errorf("Expected ErrTailPositionLost once a6 is removed, got %v", tail.Err())
+		}
+	})
+	t.Run("Waits past the read timeout", func(t *testing.T) {
+		activities.SetTimeouts(bark.Timeouts{Read: 20 * time.Millisecond})
+		defer activities.SetTimeouts(bark.Timeouts{})
+		tail, err := activities.Tail(nil, &bark.TailOptions{After: "a9"}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer tail.Close(ctx)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			activities.InsertMany([]*Activity{activity("a10", "login")}, ctx)
+		}()
+		if id := next(tail, ctx); id != "a10" {
+			t.Errorf("Expected a10, got %s", id)
+		}
+	})
+	t.Run("Needs a capped collection", func(t *testing.T) {
+		if _, err := bark.NewCollection[*Dog](DogCollectionName).Tail(nil, nil, ctx); err == nil {
+			t.Error("Expected an error tailing a collection that isn't capped")
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -18,8 +19,7 @@ type ModelWithCollection interface {
 
 // A collection of models
 type Collection[T ModelWithCollection] struct {
-	Name       string
-	collection *mongo.Collection
+	Name string
 }
 
 // Creates a new collection
@@ -27,66 +27,83 @@ func NewCollection[T ModelWithCollection](name string) *Collection[T] {
 	return &Collection[T]{Name: name}
 }
 
-// Returns the mongo collection
+// Returns the mongo collection in the context's database
 func (c *Collection[T]) MongoCollection(ctx context.Context) (*mongo.Collection, error) {
 	mockError, ok := ctx.Value(MockDbErrorKey).(string)
 	if ok {
 		return nil, errors.New(mockError)
 	}
-	if c.collection == nil {
-		if c.Name == "" {
-			return nil, fmt.Errorf("collection name is required")
-		}
-		db, err := Db(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get database: %v", err)
-		}
-		c.collection = db.Collection(c.Name)
+	if c.Name == "" {
+		return nil, fmt.Errorf("collection name is required")
 	}
-	return c.collection, nil
+	// Not cached on the collection since the database comes from the context, Db keeps the connection
+	db, err := Db(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+	return db.Collection(c.Name), nil
 }
 
 // Finds all documents matching the filter and returns a slice of T
+// Populates the reference fields named by WithPopulate or WithPopulateLookup
 func (c *Collection[T]) Find(filter bson.M, opts *options.FindOptionsBuilder, ctx context.Context) ([]T, error) {
 	var results []T
-	collection, err := c.MongoCollection(ctx)
+	if populate := populateFrom(ctx); populate != nil && populate.lookup {
+		return c.findWithLookup(filter, opts, populate.fields, ctx)
+	}
+	backend, err := c.Backend(ctx)
 	if err != nil {
-		return results, fmt.Errorf("failed to get collection to save model to: %v", err)
+		return results, fmt.Errorf("failed to get collection to save model to: %w", err)
 	}
 	// fmt.Println("collection.Name(): ", collection.Name())
 	// fmt.Println("collection.Database().Name(): ", collection.Database().Name())
-	cursor, err := collection.Find(ctx, filter, opts)
-	if err != nil && err.Error() != "mongo: no documents in result" {
-		return results, nil
-	}
+	cursor, err := backend.Find(ctx, filter, opts)
 	if err != nil {
-		return results, fmt.Errorf("error fetching documents: %v", err)
+		return results, fmt.Errorf("error fetching documents: %w", err)
 	}
-	if err = cursor.All(ctx, &results); err != nil {
-		return results, fmt.Errorf("error decoding documents: %v", err)
+	if results, err = c.decodeAll(writeBackBackend(backend, opts), cursor, ctx); err != nil {
+		return results, fmt.Errorf("error decoding documents: %w", err)
 	}
 	for i := range results {
 		results[i].SetCollectionName(c.Name)
 	}
+	if err := c.populate(results, ctx); err != nil {
+		return results, err
+	}
 	return results, nil
 }
 
 // Finds a single document matching the filter
+// The result comes from the collection's cache when it has one
+// Populates the reference fields named by WithPopulate or WithPopulateLookup
 func (c *Collection[T]) FindOne(filter bson.M, ctx context.Context) (T, error) {
-	collection, err := c.MongoCollection(ctx)
+	backend, err := c.Backend(ctx)
 	if err != nil {
-		return *new(T), fmt.Errorf("failed to get collection to save model to: %v", err)
+		return *new(T), fmt.Errorf("failed to get collection to save model to: %w", err)
 	}
 	obj := *new(T)
-	err = collection.FindOne(ctx, filter).Decode(&obj)
+	fetch := func(ctx context.Context) (bson.Raw, error) { return backend.FindOne(ctx, filter, nil) }
+	var raw bson.Raw
+	// Transactions can see their own uncommitted writes, so they skip the cache
+	if cache := configFor(c.Name).currentCache(); cache != nil && !InTransaction(ctx) {
+		raw, err = cache.load(c.Name, filter, ctx, fetch)
+	} else {
+		raw, err = fetch(ctx)
+	}
 	if err == mongo.ErrNoDocuments {
 		return *new(T), ErrNotFound
 	}
 	if err != nil {
-		return *new(T), fmt.Errorf("error fetching documents: %v", err)
+		return *new(T), fmt.Errorf("error fetching documents: %w", err)
+	}
+	if err = c.decode(backend, raw, &obj, ctx); err != nil {
+		return *new(T), fmt.Errorf("error decoding document: %w", err)
 	}
 	obj.SetCollectionName(c.Name)
 	// fmt.Println("obj.Name(): ", obj.Name())
+	if err := c.populate([]T{obj}, ctx); err != nil {
+		return *new(T), err
+	}
 	return obj, nil
 }
 
@@ -97,62 +114,297 @@ func (c *Collection[T]) All(ctx context.Context) ([]T, error) {
 
 // Returns the number of documents matching the filter
 func (c *Collection[T]) Count(filter bson.M, ctx context.Context) (int64, error) {
-	collection, err := c.MongoCollection(ctx)
+	backend, err := c.Backend(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get collection to count: %v", err)
+		return 0, fmt.Errorf("failed to get collection to count: %w", err)
 	}
-	return collection.CountDocuments(ctx, filter)
+	return backend.CountDocuments(ctx, filter)
 }
 
 // Returns and counts all documents matching the filter
 func (c *Collection[T]) FindAndCount(filter bson.M, opts *options.FindOptionsBuilder, ctx context.Context) ([]T, int64, error) {
-	collection, err := c.MongoCollection(ctx)
+	backend, err := c.Backend(ctx)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get collection to find and count: %v", err)
+		return nil, 0, fmt.Errorf("failed to get collection to find and count: %w", err)
 	}
-	cursor, err := collection.Find(ctx, filter, opts)
+	cursor, err := backend.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error fetching documents: %v", err)
+		return nil, 0, fmt.Errorf("error fetching documents: %w", err)
 	}
-	count, err := collection.CountDocuments(ctx, filter)
+	count, err := backend.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error counting documents: %v", err)
+		return nil, 0, fmt.Errorf("error counting documents: %w", err)
 	}
-	var results []T
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, 0, fmt.Errorf("error decoding documents: %v", err)
+	results, err := c.decodeAll(writeBackBackend(backend, opts), cursor, ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error decoding documents: %w", err)
+	}
+	if err := c.populate(results, ctx); err != nil {
+		return nil, 0, err
 	}
 	return results, count, nil
 }
 
+// Decodes every document in the cursor, upgrading any that are behind the current schema version
+func (c *Collection[T]) decodeAll(backend Backend, cursor Cursor, ctx context.Context) ([]T, error) {
+	defer cursor.Close(ctx)
+	var results []T
+	for cursor.Next(ctx) {
+		obj := *new(T)
+		if err := c.decode(backend, cursor.Current(), &obj, ctx); err != nil {
+			return nil, err
+		}
+		results = append(results, obj)
+	}
+	return results, cursor.Err()
+}
+
+// Splits the fields bark added to a document, like a text score, from the fields of the model
+// so they aren't decoded or written back with it
+func splitDocument(raw bson.Raw, added func(key string) bool) (bson.Raw, map[string]any, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, err
+	}
+	extra := make(map[string]any)
+	model := doc[:0:0]
+	for _, elem := range doc {
+		if added(elem.Key) {
+			extra[elem.Key] = elem.Value
+			continue
+		}
+		model = append(model, elem)
+	}
+	data, err := bson.Marshal(model)
+	return data, extra, err
+}
+
 // Gets a single document with matching id
+// Goes through the collection's Loader if the context has one
 func (c *Collection[T]) Get(id string, ctx context.Context) (T, error) {
+	if loader := loaderFrom[T](c.Name, ctx); loader != nil {
+		return loader.Load(id, ctx)
+	}
 	filter := bson.M{"Id": id}
 	return c.FindOne(filter, ctx)
 }
 
+// Gets the documents with matching ids, in the same order as the ids
+// Ids with no document are left out of the results and reported in missing
+// Goes through the collection's Loader if the context has one
+func (c *Collection[T]) GetMany(ids []string, ctx context.Context) (results []T, missing map[string]bool, err error) {
+	missing = make(map[string]bool)
+	if loader := loaderFrom[T](c.Name, ctx); loader != nil {
+		objs, errs := loader.LoadMany(ids, ctx)
+		for i, id := range ids {
+			switch {
+			case errs[i] == ErrNotFound:
+				missing[id] = true
+			case errs[i] != nil:
+				return nil, nil, errs[i]
+			default:
+				results = append(results, objs[i])
+			}
+		}
+		return results, missing, nil
+	}
+	unique := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	objs, err := c.Find(bson.M{"Id": bson.M{"$in": unique}}, nil, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byId := make(map[string]T, len(objs))
+	for _, obj := range objs {
+		byId[modelId(obj)] = obj
+	}
+	for _, id := range ids {
+		if obj, ok := byId[id]; ok {
+			results = append(results, obj)
+		} else {
+			missing[id] = true
+		}
+	}
+	return results, missing, nil
+}
+
+// Gets a single document with matching id and panics if it can't
+// Meant for scripts and tests
+func (c *Collection[T]) MustGet(id string, ctx context.Context) T {
+	obj, err := c.Get(id, ctx)
+	if err != nil {
+		panic(fmt.Errorf("error getting %s %s: %w", c.Name, id, err))
+	}
+	return obj
+}
+
+// Gets the documents with matching ids and panics if it can't or if any are missing
+// Meant for scripts and tests
+func (c *Collection[T]) MustGetMany(ids []string, ctx context.Context) []T {
+	results, missing, err := c.GetMany(ids, ctx)
+	if err != nil {
+		panic(fmt.Errorf("error getting %s: %w", c.Name, err))
+	}
+	for _, id := range ids {
+		if missing[id] {
+			panic(fmt.Errorf("error getting %s %s: %w", c.Name, id, ErrNotFound))
+		}
+	}
+	return results
+}
+
+// Returns true if a document matches the filter
+// Only the _id of one document is fetched
+func (c *Collection[T]) Exists(filter bson.M, ctx context.Context) (bool, error) {
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get collection to check existence: %w", err)
+	}
+	_, err = backend.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1}))
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking existence: %w", err)
+	}
+	return true, nil
+}
+
+// Returns true if a document has the id
+func (c *Collection[T]) ExistsById(id string, ctx context.Context) (bool, error) {
+	return c.Exists(bson.M{"Id": id}, ctx)
+}
+
 // Deletes a single document matching the filter
 func (c *Collection[T]) DeleteOne(filter bson.M, ctx context.Context) (*Result, error) {
-	collection, err := c.MongoCollection(ctx)
+	backend, err := c.Backend(ctx)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("error getting collection to clear: %v", err)
+		return EmptyResult(), fmt.Errorf("error getting collection to clear: %w", err)
 	}
-	res, err := collection.DeleteOne(ctx, filter)
+	res, err := backend.DeleteOne(ctx, filter)
 	if err != nil {
-		return ResultFromDelete(res), fmt.Errorf("error deleting documents: %v", err)
+		return EmptyResult(), fmt.Errorf("error deleting documents: %w", err)
 	}
 	return ResultFromDelete(res), nil
 }
 
 // Deletes all documents matching the filter
 func (c *Collection[T]) DeleteMany(filter bson.M, ctx context.Context) (*Result, error) {
-	collection, err := c.MongoCollection(ctx)
+	backend, err := c.Backend(ctx)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("error getting collection to clear: %v", err)
+		return EmptyResult(), fmt.Errorf("error getting collection to clear: %w", err)
 	}
-	res, err := collection.DeleteMany(ctx, filter)
+	res, err := backend.DeleteMany(ctx, filter)
 	if err != nil {
-		return ResultFromDelete(res), fmt.Errorf("error deleting documents: %v", err)
+		return EmptyResult(), fmt.Errorf("error deleting documents: %w", err)
 	}
 	return ResultFromDelete(res), nil
 }
+
+// The code MongoDB fails with when creating a collection that already exists
+const namespaceExists = 48
+
+// Creates the collection with the options configured for it, like SetTimeSeries or CreateCapped
+// Does nothing if the collection already exists, even if it has different options
+func (c *Collection[T]) EnsureCollection(ctx context.Context) error {
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get collection to create: %w", err)
+	}
+	err = backend.CreateCollection(ctx, configFor(c.Name).createOptions())
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceExists {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating collection: %w", err)
+	}
+	return nil
+}
+
+// Returns the options the collection is created with
+func (cfg *collectionConfig) createOptions() *options.CreateCollectionOptionsBuilder {
+	opts := options.CreateCollection()
+	if capped := cfg.currentCapped(); capped != nil {
+		opts.SetCapped(true).SetSizeInBytes(capped.size)
+		if capped.max > 0 {
+			opts.SetMaxDocuments(capped.max)
+		}
+	}
+	if ts := cfg.currentTimeSeries(); ts != nil {
+		tsOpts := options.TimeSeries().SetTimeField(ts.TimeField)
+		if ts.MetaField != "" {
+			tsOpts.SetMetaField(ts.MetaField)
+		}
+		if ts.Granularity != "" {
+			tsOpts.SetGranularity(ts.Granularity)
+		}
+		opts.SetTimeSeriesOptions(tsOpts)
+		if ts.ExpireAfter > 0 {
+			opts.SetExpireAfterSeconds(int64(ts.ExpireAfter / time.Second))
+		}
+	}
+	return opts
+}
+
+// Inserts the objects without the upsert SaveModel uses, giving them ids and stamps like SaveModel does
+// Use it for collections that don't allow upserts, like time-series collections
+func (c *Collection[T]) InsertMany(objs []T, ctx context.Context) (*Result, error) {
+	if len(objs) == 0 {
+		return EmptyResult(), nil
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return EmptyResult(), fmt.Errorf("failed to get collection to insert into: %w", err)
+	}
+	schemaVersion := configFor(c.Name).currentSchemaVersion()
+	docs := make([]any, len(objs))
+	for i, obj := range objs {
+		doc := bson.M{}
+		data, err := bson.Marshal(obj)
+		if err != nil {
+			return EmptyResult(), fmt.Errorf("failed to marshal model to bson: %w", err)
+		}
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return EmptyResult(), fmt.Errorf("failed to marshal model to bson: %w", err)
+		}
+		id := modelId(obj)
+		if id == "" {
+			id = c.NewID(ctx)
+		}
+		doc["_id"], doc["Id"] = id, id
+		doc["CreatedOn"] = Now(ctx)
+		doc["Version"] = 1
+		if schemaVersion > 0 {
+			doc["SchemaVersion"] = schemaVersion
+		}
+		// The object gets the same id and stamps as the stored document
+		if data, err = bson.Marshal(doc); err == nil {
+			err = bson.Unmarshal(data, obj)
+		}
+		if err != nil {
+			return EmptyResult(), fmt.Errorf("failed to stamp model: %w", err)
+		}
+		docs[i] = doc
+	}
+	res, err := backend.InsertMany(ctx, docs)
+	if err != nil {
+		return EmptyResult(), fmt.Errorf("error inserting documents: %w", err)
+	}
+	return &Result{Inserted: int64(len(res.InsertedIDs))}, nil
+}
+
+// Deletes every document in the collection
+// To prevent accidents this only works on databases whose names start with "test"
+func (c *Collection[T]) Clear(ctx context.Context) (*Result, error) {
+	if err := requireTestDb(ctx); err != nil {
+		return EmptyResult(), err
+	}
+	return c.DeleteMany(bson.M{}, ctx)
+}
@@ -2,6 +2,7 @@ package bark_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/jaredtmartin/bark-go-mongo"
@@ -49,12 +50,12 @@ func TestMongoCollection(t *testing.T) {
 
 	// Test getting mongo collection first time
 
-	t.Run("Test getting mongo collection second time (cached)", func(t *testing.T) {
+	t.Run("Test getting mongo collection second time", func(t *testing.T) {
 		mongoCol1, err := dogs.MongoCollection(ctx)
 		if err != nil {
 			t.Errorf("Expected no error, got %v", err)
 		}
-		// Test getting mongo collection second time (cached)
+		// Test getting mongo collection second time
 		mongoCol2, err := dogs.MongoCollection(ctx)
 		if err != nil {
 			t.Errorf("Expected no error, got %v", err)
@@ -62,8 +63,8 @@ func TestMongoCollection(t *testing.T) {
 		if mongoCol2 == nil {
 			t.Error("Expected non-nil mongo collection")
 		}
-		if mongoCol1 != mongoCol2 {
-			t.Error("Expected same mongo collection instance on second call")
+		if mongoCol1.Name() != mongoCol2.Name() || mongoCol1.Database().Name() != mongoCol2.Database().Name() {
+			t.Error("Expected the same mongo collection on second call")
 		}
 	})
 	t.Run("Test handling error when collection name is empty", func(t *testing.T) {
@@ -713,3 +714,88 @@ func TestDeleteMany(t *testing.T) {
 		}
 	})
 }
+func TestClear(t *testing.T) {
+	ctx := setupMemoryTest("Clear", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}, {Name: "Spot", Id: "2222"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	t.Run("Refuses databases not starting with test", func(t *testing.T) {
+		prodCtx := context.WithValue(ctx, bark.DbNameKey, "production")
+		if _, err := dogs.Clear(prodCtx); !errors.Is(err, bark.ErrClearCanOnlyBeUsedOnDbsStartingWithTest) {
+			t.Errorf("Expected ErrClearCanOnlyBeUsedOnDbsStartingWithTest, got %v", err)
+		}
+		if err := bark.DropDatabase(prodCtx); !errors.Is(err, bark.ErrClearCanOnlyBeUsedOnDbsStartingWithTest) {
+			t.Errorf("Expected ErrClearCanOnlyBeUsedOnDbsStartingWithTest, got %v", err)
+		}
+	})
+	t.Run("Deletes every document", func(t *testing.T) {
+		result, err := dogs.Clear(ctx)
+		if err != nil || result.Deleted != 2 {
+			t.Errorf("Expected 2 deleted, got %v and %v", result, err)
+		}
+	})
+	t.Run("DropDatabase empties the database", func(t *testing.T) {
+		SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}}, ctx)
+		if err := bark.DropDatabase(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := dogs.Count(bson.M{}, ctx)
+		if count != 0 {
+			t.Errorf("Expected no dogs, got %d", count)
+		}
+	})
+}
+
+func TestGetMany(t *testing.T) {
+	ctx := setupMemoryTest("GetMany", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}, {Name: "Spot", Id: "2222"}, {Name: "Rex", Id: "3333"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	for name, ctx := range map[string]context.Context{
+		"Without a loader": ctx,
+		"With a loader":    bark.WithLoader(ctx, bark.NewLoader(dogs, nil)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			results, missing, err := dogs.GetMany([]string{"3333", "9999", "1111"}, ctx)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(results) != 2 || results[0].Name != "Rex" || results[1].Name != "Fido" {
+				t.Errorf("Expected Rex and Fido in order, got %v", results)
+			}
+			if len(missing) != 1 || !missing["9999"] {
+				t.Errorf("Expected 9999 to be missing, got %v", missing)
+			}
+		})
+	}
+	t.Run("MustGet panics on missing ids", func(t *testing.T) {
+		if dog := dogs.MustGet("2222", ctx); dog.Name != "Spot" {
+			t.Errorf("Expected Spot, got %v", dog)
+		}
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected a panic")
+			}
+		}()
+		dogs.MustGetMany([]string{"1111", "9999"}, ctx)
+	})
+}
+
+func TestExists(t *testing.T) {
+	ctx := setupMemoryTest("Exists", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	if exists, err := dogs.Exists(bson.M{"Name": "Fido"}, ctx); err != nil || !exists {
+		t.Errorf("Expected Fido to exist, got %v and %v", exists, err)
+	}
+	if exists, err := dogs.ExistsById("9999", ctx); err != nil || exists {
+		t.Errorf("Expected 9999 not to exist, got %v and %v", exists, err)
+	}
+	if _, err := dogs.Exists(bson.M{}, context.WithValue(ctx, bark.MockDbErrorKey, "boom")); err == nil {
+		t.Error("Expected an error")
+	}
+}
@@ -17,10 +17,10 @@ var ErrNotFound = errors.New("not found")
 func Find(collection *mongo.Collection, filter bson.M, results interface{}, opts *options.FindOptionsBuilder, ctx context.Context) error {
 	cursor, err := collection.Find(ctx, filter, opts)
 	if err != nil {
-		return fmt.Errorf("error fetching documents: %v", err)
+		return fmt.Errorf("error fetching documents: %w", err)
 	}
 	if err = cursor.All(ctx, results); err != nil {
-		return fmt.Errorf("error decoding documents: %v", err)
+		return fmt.Errorf("error decoding documents: %w", err)
 	}
 	return nil
 }
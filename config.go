@@ -0,0 +1,36 @@
+package bark
+
+import "sync"
+
+// Settings shared by every Collection with the same name.
+// Models create their own Collection when saving, so anything that
+// needs to be seen by both a Collection and a Model lives here.
+type collectionConfig struct {
+	mu                sync.RWMutex
+	schemaVersion     int
+	upgrades          map[int]UpgradeFunc
+	writeBackUpgrades bool
+	idGenerator       IDGenerator
+	timeouts          Timeouts
+	retryPolicy       *RetryPolicy
+	cache             *collectionCache
+	timeSeries        *TimeSeries
+	capped            *capped
+	validationLevel   ValidationLevel
+	validationAction  ValidationAction
+}
+
+var configsMu sync.Mutex
+var configs = make(map[string]*collectionConfig)
+
+// Returns the shared settings for the named collection, creating them if needed
+func configFor(name string) *collectionConfig {
+	configsMu.Lock()
+	defer configsMu.Unlock()
+	cfg, ok := configs[name]
+	if !ok {
+		cfg = &collectionConfig{upgrades: make(map[int]UpgradeFunc)}
+		configs[name] = cfg
+	}
+	return cfg
+}
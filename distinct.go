@@ -0,0 +1,93 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Returns the distinct values of the field among the documents matching the filter
+// The elements of array fields count as values of their own
+func Distinct[V any, T ModelWithCollection](c *Collection[T], field string, filter bson.M, ctx context.Context) ([]V, error) {
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to find distinct values in: %w", err)
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	raw, err := backend.Distinct(ctx, field, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error finding distinct values: %w", err)
+	}
+	values, err := raw.Values()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding distinct values: %w", err)
+	}
+	results := make([]V, len(values))
+	for i, value := range values {
+		if err := value.Unmarshal(&results[i]); err != nil {
+			return nil, fmt.Errorf("error decoding distinct value %v: %w", value, err)
+		}
+	}
+	return results, nil
+}
+
+// The number of documents with a value of a field
+type FacetCount struct {
+	Value any   `bson:"_id"`
+	Count int64 `bson:"count"`
+}
+
+// Returns the number of documents matching the filter for each value of each field, in a single $facet aggregation
+// Counts are sorted from the most common value, the elements of array fields are counted separately
+// and documents missing a field aren't counted for it
+func (c *Collection[T]) Facets(filter bson.M, fields []string, ctx context.Context) (map[string][]FacetCount, error) {
+	// MongoDB rejects a $facet stage without any facets
+	if len(fields) == 0 {
+		return map[string][]FacetCount{}, nil
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to count facets in: %w", err)
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	// Facet names can't contain dots, so the facets are named by position
+	facets := bson.D{}
+	for i, field := range fields {
+		facets = append(facets, bson.E{Key: fmt.Sprintf("f%d", i), Value: bson.A{
+			bson.D{{Key: "$unwind", Value: "$" + field}},
+			bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$" + field}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		}})
+	}
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$facet", Value: facets}},
+	}
+	cursor, err := backend.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error counting facets: %w", err)
+	}
+	defer cursor.Close(ctx)
+	counts := make(map[string][]FacetCount, len(fields))
+	if cursor.Next(ctx) {
+		if err := bson.Unmarshal(cursor.Current(), &counts); err != nil {
+			return nil, fmt.Errorf("error decoding facets: %w", err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error counting facets: %w", err)
+	}
+	results := make(map[string][]FacetCount, len(fields))
+	for i, field := range fields {
+		results[field] = counts[fmt.Sprintf("f%d", i)]
+		if results[field] == nil {
+			results[field] = []FacetCount{}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,67 @@
+package bark_test
+
+import (
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestDistinct(t *testing.T) {
+	ctx := setupMemoryTest("Distinct", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{
+		{Name: "Fido", Id: "1111", Age: 3},
+		{Name: "Spot", Id: "2222", Age: 5},
+		{Name: "Rex", Id: "3333", Age: 3},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	ages, err := bark.Distinct[int](dogs, "Age", nil, ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ages) != 2 || ages[0] != 3 || ages[1] != 5 {
+		t.Errorf("Expected ages 3 and 5, got %v", ages)
+	}
+	names, err := bark.Distinct[string](dogs, "Name", bson.M{"Age": 3}, ctx)
+	if err != nil || len(names) != 2 || names[0] != "Fido" || names[1] != "Rex" {
+		t.Errorf("Expected Fido and Rex, got %v and %v", names, err)
+	}
+	if _, err := bark.Distinct[int](dogs, "Name", nil, ctx); err == nil {
+		t.Error("Expected an error decoding names as ints")
+	}
+}
+
+func TestFacets(t *testing.T) {
+	ctx := setupMemoryTest("Facets", "2024-03-27T19:55:38.782Z", t)
+	insertAll("pets", ctx, t,
+		bson.M{"_id": "p1", "Name": "Fido", "OwnerId": "o1", "ToyIds": bson.A{"t1", "t2"}},
+		bson.M{"_id": "p2", "Name": "Spot", "OwnerId": "o1", "ToyIds": bson.A{"t1"}},
+		bson.M{"_id": "p3", "Name": "Rex", "OwnerId": "o2"},
+		bson.M{"_id": "p4", "Name": "Max"})
+	pets := bark.NewCollection[*Pet]("pets")
+	facets, err := pets.Facets(bson.M{"Name": bson.M{"$ne": "Max"}}, []string{"OwnerId", "ToyIds", "Breed"}, ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	owners := facets["OwnerId"]
+	if len(owners) != 2 || owners[0] != (bark.FacetCount{Value: "o1", Count: 2}) || owners[1] != (bark.FacetCount{Value: "o2", Count: 1}) {
+		t.Errorf("Expected o1 twice and o2 once, got %v", owners)
+	}
+	toys := facets["ToyIds"]
+	if len(toys) != 2 || toys[0] != (bark.FacetCount{Value: "t1", Count: 2}) || toys[1] != (bark.FacetCount{Value: "t2", Count: 1}) {
+		t.Errorf("Expected array elements to be counted separately, got %v", toys)
+	}
+	if breeds, ok := facets["Breed"]; !ok || len(breeds) != 0 {
+		t.Errorf("Expected no breeds, got %v", breeds)
+	}
+	faults := bark.NewFaults()
+	facets, err = pets.Facets(nil, nil, bark.WithFaults(ctx, faults))
+	if err != nil || facets == nil || len(facets) != 0 {
+		t.Errorf("Expected an empty map without fields, got %v and %v", facets, err)
+	}
+	if calls := faults.Calls("pets", "Aggregate"); calls != 0 {
+		t.Errorf("Expected no aggregation without fields, got %d", calls)
+	}
+}
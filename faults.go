@@ -0,0 +1,220 @@
+package bark
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const FaultsKey Key = "faults"
+
+// Describes a failure to inject into backend calls
+// A fault with Nth set fires only on that matching call, otherwise it fires on every matching call
+// until it has fired Times times (0 for no limit)
+type Fault struct {
+	// The collection to fail, empty for any collection
+	Collection string
+	// The Backend method to fail, e.g. "UpdateOne", empty for any operation
+	Operation string
+	// Fires only on the nth matching call, counting from 1
+	Nth int
+	// Maximum number of times to fire when Nth is not set, 0 for no limit
+	Times int
+	// How long to wait before the call runs
+	Delay time.Duration
+	// The error to return, nil to only add the delay
+	Err error
+	// For Find and Aggregate, lets the cursor return this many documents before failing with Err
+	FailCursorAfter int
+}
+
+// A set of faults injected into the backend calls made with a context
+type Faults struct {
+	mu     sync.Mutex
+	faults []*faultState
+	calls  map[faultCall]int
+}
+
+// Identifies an operation on a collection for counting calls
+type faultCall struct {
+	collection string
+	operation  string
+}
+
+// Tracks how often a fault has matched and fired
+type faultState struct {
+	Fault
+	matched int
+	fired   int
+}
+
+// Creates a set of faults
+func NewFaults(faults ...Fault) *Faults {
+	f := &Faults{calls: make(map[faultCall]int)}
+	for _, fault := range faults {
+		f.Add(fault)
+	}
+	return f
+}
+
+// Adds a fault to the set
+func (f *Faults) Add(fault Fault) *Faults {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &faultState{Fault: fault})
+	return f
+}
+
+// Returns the number of calls made to the operation on the collection, empty strings match any
+func (f *Faults) Calls(collection string, operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for call, calls := range f.calls {
+		if (collection == "" || collection == call.collection) && (operation == "" || operation == call.operation) {
+			count += calls
+		}
+	}
+	return count
+}
+
+// Returns a context that injects the faults into the backend calls made with it
+func WithFaults(ctx context.Context, faults *Faults) context.Context {
+	return context.WithValue(ctx, FaultsKey, faults)
+}
+
+// Returns the first fault that fires for the operation, or nil
+func (f *Faults) next(op *Operation) *Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[faultCall{op.Collection, op.Name}]++
+	var firing *Fault
+	for _, state := range f.faults {
+		if state.Collection != "" && state.Collection != op.Collection {
+			continue
+		}
+		if state.Operation != "" && state.Operation != op.Name {
+			continue
+		}
+		state.matched++
+		if firing != nil {
+			continue
+		}
+		if state.Nth > 0 && state.matched != state.Nth {
+			continue
+		}
+		if state.Nth == 0 && state.Times > 0 && state.fired >= state.Times {
+			continue
+		}
+		state.fired++
+		fault := state.Fault
+		firing = &fault
+	}
+	return firing
+}
+
+// Injects the fault that fires for the operation, if any
+func (f *Faults) intercept(ctx context.Context, op *Operation, next func(ctx context.Context) error) error {
+	fault := f.next(op)
+	if fault == nil {
+		return next(ctx)
+	}
+	if fault.Delay > 0 {
+		timer := time.NewTimer(fault.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if fault.Err == nil {
+		return next(ctx)
+	}
+	if fault.FailCursorAfter > 0 && (op.Name == "Find" || op.Name == "Aggregate") {
+		if err := next(ctx); err != nil {
+			return err
+		}
+		op.Cursor = &faultyCursor{Cursor: op.Cursor, remaining: fault.FailCursorAfter, fault: fault.Err}
+		return nil
+	}
+	return fault.Err
+}
+
+// A cursor that fails after returning a number of documents
+// Like a cursor fetching its next batch, it also fails once the context is done
+type faultyCursor struct {
+	Cursor
+	remaining int
+	fault     error
+	err       error
+}
+
+func (c *faultyCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+	if c.remaining == 0 {
+		c.err = c.fault
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	c.remaining--
+	return c.Cursor.Next(ctx)
+}
+
+func (c *faultyCursor) Current() bson.Raw {
+	if c.err != nil {
+		return nil
+	}
+	return c.Cursor.Current()
+}
+
+func (c *faultyCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Cursor.Err()
+}
+
+// Returns a duplicate key error like the one MongoDB returns for a unique index violation
+func DuplicateKeyError() error {
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: "E11000 duplicate key error (injected)",
+	}}}
+}
+
+// Returns a write concern error like the one MongoDB returns when a write isn't acknowledged in time
+func WriteConcernError() error {
+	return mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{
+		Name:    "WriteConcernFailed",
+		Code:    64,
+		Message: "waiting for replication timed out (injected)",
+	}}
+}
+
+// Returns a network error like the one the driver returns when a connection drops
+// It has no RetryableWriteError label, since the server may have applied a write before the connection dropped
+func NetworkError() error {
+	return mongo.CommandError{
+		Message: "connection reset by peer (injected)",
+		Labels:  []string{"NetworkError"},
+	}
+}
+
+// Returns a transient network error that is labeled as safe to retry
+func TransientError() error {
+	return mongo.CommandError{
+		Code:    91,
+		Name:    "ShutdownInProgress",
+		Message: "server is shutting down (injected)",
+		Labels:  []string{"RetryableWriteError", transientTransactionError},
+	}
+}
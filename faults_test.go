@@ -0,0 +1,107 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestFaults(t *testing.T) {
+	ctx := setupMemoryTest("Faults", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{
+		{Name: "Fido", Id: "1111", Age: 3},
+		{Name: "Spot", Id: "2222", Age: 5},
+		{Name: "Rex", Id: "3333", Age: 7},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	failure := errors.New("injected failure")
+
+	t.Run("Fails only the nth matching call", func(t *testing.T) {
+		faults := bark.NewFaults(bark.Fault{Collection: DogCollectionName, Operation: "UpdateOne", Nth: 3, Err: failure})
+		faultCtx := bark.WithFaults(ctx, faults)
+		var errs []error
+		for i := 0; i < 4; i++ {
+			dog, _ := dogs.Get("1111", faultCtx)
+			_, err := dog.Save(faultCtx)
+			errs = append(errs, err)
+		}
+		for i, err := range errs {
+			if i == 2 && !errors.Is(err, failure) {
+				t.Errorf("Expected the 3rd save to fail, got %v", err)
+			}
+			if i != 2 && err != nil {
+				t.Errorf("Expected save %d to succeed, got %v", i+1, err)
+			}
+		}
+		if calls := faults.Calls(DogCollectionName, "UpdateOne"); calls != 4 {
+			t.Errorf("Expected 4 UpdateOne calls, got %d", calls)
+		}
+	})
+	t.Run("Ignores other collections and operations", func(t *testing.T) {
+		faultCtx := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Collection: "cats", Err: failure}))
+		if _, err := dogs.Count(bson.M{}, faultCtx); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		faultCtx = bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "DeleteOne", Err: failure}))
+		if _, err := dogs.Find(bson.M{}, nil, faultCtx); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+	t.Run("Stops after firing Times times", func(t *testing.T) {
+		faultCtx := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "CountDocuments", Times: 2, Err: failure}))
+		for i := 0; i < 3; i++ {
+			_, err := dogs.Count(bson.M{}, faultCtx)
+			if i < 2 && !errors.Is(err, failure) {
+				t.Errorf("Expected call %d to fail, got %v", i+1, err)
+			}
+			if i == 2 && err != nil {
+				t.Errorf("Expected the 3rd call to succeed, got %v", err)
+			}
+		}
+	})
+	t.Run("Returns driver errors", func(t *testing.T) {
+		faultCtx := bark.WithFaults(ctx, bark.NewFaults(
+			bark.Fault{Operation: "UpdateOne", Err: bark.DuplicateKeyError()},
+			bark.Fault{Operation: "DeleteOne", Err: bark.WriteConcernError()},
+		))
+		_, err := NewDog("Max").Save(faultCtx)
+		if !mongo.IsDuplicateKeyError(err) {
+			t.Errorf("Expected a duplicate key error, got %v", err)
+		}
+		dog, _ := dogs.Get("2222", faultCtx)
+		_, err = dog.Delete(faultCtx)
+		var writeErr mongo.WriteException
+		if !errors.As(err, &writeErr) || writeErr.WriteConcernError == nil {
+			t.Errorf("Expected a write concern error, got %v", err)
+		}
+	})
+	t.Run("Injects latency", func(t *testing.T) {
+		faultCtx := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "FindOne", Delay: 20 * time.Millisecond}))
+		start := time.Now()
+		if _, err := dogs.Get("1111", faultCtx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("Expected the call to be delayed, took %v", elapsed)
+		}
+		timeoutCtx, cancel := context.WithTimeout(faultCtx, time.Millisecond)
+		defer cancel()
+		if _, err := dogs.Get("1111", timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the delay to respect the deadline, got %v", err)
+		}
+	})
+	t.Run("Fails mid-cursor", func(t *testing.T) {
+		faultCtx := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "Find", FailCursorAfter: 2, Err: failure}))
+		_, err := dogs.Find(bson.M{}, nil, faultCtx)
+		if !errors.Is(err, failure) {
+			t.Errorf("Expected the cursor to fail, got %v", err)
+		}
+	})
+}
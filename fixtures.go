@@ -0,0 +1,279 @@
+package bark
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownFixture = errors.New("unknown fixture")
+
+// The documents created by loading fixtures, looked up by fixture name
+type Fixtures struct {
+	ids         map[string]string
+	docs        map[string]bson.M
+	collections map[string]string
+}
+
+// Returns the id given to the named fixture, or an empty string if there is no such fixture
+func (f *Fixtures) Id(name string) string {
+	return f.ids[name]
+}
+
+// Returns the document inserted for the named fixture
+func (f *Fixtures) Doc(name string) (bson.M, bool) {
+	doc, ok := f.docs[name]
+	return doc, ok
+}
+
+// Returns the named fixture decoded into a model
+func Fixture[T ModelWithCollection](f *Fixtures, name string) (T, error) {
+	obj := *new(T)
+	doc, ok := f.docs[name]
+	if !ok {
+		return obj, fmt.Errorf("%w: %s", ErrUnknownFixture, name)
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return obj, fmt.Errorf("error encoding fixture %s: %w", name, err)
+	}
+	if err := bson.Unmarshal(data, &obj); err != nil {
+		return obj, fmt.Errorf("error decoding fixture %s: %w", name, err)
+	}
+	obj.SetCollectionName(f.collections[name])
+	return obj, nil
+}
+
+// Loads fixtures from a YAML or JSON file, see LoadFixtures
+func LoadFixtureFile(path string, ctx context.Context) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixture file: %w", err)
+	}
+	fixtures, err := LoadFixtures(data, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+// Clears the collections named in the YAML or JSON data and inserts their fixtures
+// Like Collection.Clear this only works on databases whose names start with "test"
+// The data maps collection names to named documents:
+//
+//	dogs:
+//	  fido:
+//	    Name: Fido
+//	    OwnerId: "{{ref alice}}"
+//	    BornOn: "{{now -72h}}"
+//
+// String values can use templates: {{ref name}} is the id of another fixture,
+// {{now}} is Now(ctx) and {{now -24h}} is shifted by a duration, which may also be given in days like -3d.
+// Fixtures without an Id get one from the generator in the context, or a stable hash of their name.
+// Model fields that SaveModel would set are filled in when missing.
+func LoadFixtures(data []byte, ctx context.Context) (*Fixtures, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing fixtures: %w", err)
+	}
+	type entry struct {
+		collection string
+		name       string
+		doc        map[string]any
+	}
+	var entries []entry
+	var collections []string
+	if len(root.Content) > 0 {
+		top := root.Content[0]
+		if top.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("fixtures must map collection names to fixtures")
+		}
+		for i := 0; i+1 < len(top.Content); i += 2 {
+			collection, docs := top.Content[i].Value, top.Content[i+1]
+			if docs.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("fixtures for %s must map names to documents", collection)
+			}
+			collections = append(collections, collection)
+			for j := 0; j+1 < len(docs.Content); j += 2 {
+				var doc map[string]any
+				if err := docs.Content[j+1].Decode(&doc); err != nil {
+					return nil, fmt.Errorf("error parsing fixture %s: %w", docs.Content[j].Value, err)
+				}
+				entries = append(entries, entry{collection: collection, name: docs.Content[j].Value, doc: doc})
+			}
+		}
+	}
+
+	fixtures := &Fixtures{ids: map[string]string{}, docs: map[string]bson.M{}, collections: map[string]string{}}
+	for _, e := range entries {
+		if _, ok := fixtures.ids[e.name]; ok {
+			return nil, fmt.Errorf("duplicate fixture name %s", e.name)
+		}
+		fixtures.ids[e.name] = fixtureId(e.collection, e.name, e.doc, ctx)
+		fixtures.collections[e.name] = e.collection
+	}
+
+	now := Now(ctx)
+	inserts := map[string][]any{}
+	for _, e := range entries {
+		value, err := fixtures.expand(e.doc, now)
+		if err != nil {
+			return nil, fmt.Errorf("error in fixture %s: %w", e.name, err)
+		}
+		doc := bson.M(value.(map[string]any))
+		id := fixtures.ids[e.name]
+		doc["_id"] = id
+		doc["Id"] = id
+		setDefault(doc, "CreatedOn", now)
+		setDefault(doc, "UpdatedOn", now)
+		setDefault(doc, "Version", 1)
+		if schemaVersion := configFor(e.collection).currentSchemaVersion(); schemaVersion > 0 {
+			setDefault(doc, "SchemaVersion", schemaVersion)
+		}
+		fixtures.docs[e.name] = doc
+		inserts[e.collection] = append(inserts[e.collection], doc)
+	}
+
+	for _, name := range collections {
+		collection := NewCollection[*Model](name)
+		if _, err := collection.Clear(ctx); err != nil {
+			return nil, fmt.Errorf("error clearing %s: %w", name, err)
+		}
+		backend, err := collection.Backend(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get collection %s for fixtures: %w", name, err)
+		}
+		if len(inserts[name]) == 0 {
+			continue
+		}
+		if _, err := backend.InsertMany(ctx, inserts[name]); err != nil {
+			return nil, fmt.Errorf("error inserting fixtures into %s: %w", name, err)
+		}
+	}
+	return fixtures, nil
+}
+
+// Returns the id for a fixture, from the document, the generator in the context, or a hash of its name
+func fixtureId(collection string, name string, doc map[string]any, ctx context.Context) string {
+	if id, ok := doc["Id"].(string); ok && id != "" {
+		return id
+	}
+	if gen, ok := ctx.Value(IDGeneratorKey).(IDGenerator); ok && gen != nil {
+		return gen.NewID()
+	}
+	sum := sha1.Sum([]byte(collection + "/" + name))
+	return hex.EncodeToString(sum[:tokenLength/2])
+}
+
+// Sets the field if the document doesn't have it
+func setDefault(doc bson.M, key string, value any) {
+	if _, ok := doc[key]; !ok {
+		doc[key] = value
+	}
+}
+
+var templatePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*([^}]*?)\s*\}\}`)
+
+// Replaces the templates in the strings of the value
+func (f *Fixtures) expand(value any, now time.Time) (any, error) {
+	switch value := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(value))
+		for k, v := range value {
+			expanded, err := f.expand(v, now)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = expanded
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(value))
+		for i, v := range value {
+			expanded, err := f.expand(v, now)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = expanded
+		}
+		return out, nil
+	case string:
+		return f.expandString(value, now)
+	default:
+		return value, nil
+	}
+}
+
+// Replaces the templates in the string
+// A string that is a single template takes the template's value, so {{now}} stays a time
+func (f *Fixtures) expandString(s string, now time.Time) (any, error) {
+	matches := templatePattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) {
+		return f.evaluate(s[matches[0][2]:matches[0][3]], s[matches[0][4]:matches[0][5]], now)
+	}
+	var out strings.Builder
+	last := 0
+	for _, m := range matches {
+		value, err := f.evaluate(s[m[2]:m[3]], s[m[4]:m[5]], now)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(s[last:m[0]])
+		if t, ok := value.(time.Time); ok {
+			out.WriteString(t.Format(time.RFC3339))
+		} else {
+			fmt.Fprint(&out, value)
+		}
+		last = m[1]
+	}
+	out.WriteString(s[last:])
+	return out.String(), nil
+}
+
+// Returns the value of a single template
+func (f *Fixtures) evaluate(name string, arg string, now time.Time) (any, error) {
+	switch name {
+	case "ref":
+		id, ok := f.ids[arg]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFixture, arg)
+		}
+		return id, nil
+	case "now":
+		if arg == "" {
+			return now, nil
+		}
+		offset, err := parseOffset(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in {{now %s}}: %w", arg, err)
+		}
+		return now.Add(offset), nil
+	default:
+		return nil, fmt.Errorf("unknown template {{%s}}", name)
+	}
+}
+
+// Parses a duration that may also be given in whole days, e.g. -3d
+func parseOffset(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,107 @@
+package bark_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const dogFixtures = `
+owners:
+  alice:
+    Name: Alice
+dogs:
+  fido:
+    Name: Fido
+    Age: 3
+    OwnerId: "{{ref alice}}"
+    BornOn: "{{now -3d}}"
+    Note: "Owned by {{ref alice}} since {{now -24h}}"
+  spot:
+    Id: "2222"
+    Name: Spot
+    Age: 5
+`
+
+func TestLoadFixtures(t *testing.T) {
+	ctx := setupMemoryTest("LoadFixtures", "2024-03-27T19:55:38.782Z", t)
+	dogs := bark.NewCollection[*Dog](DogCollectionName)
+	NewDog("Stale").Save(ctx)
+
+	fixtures, err := bark.LoadFixtures([]byte(dogFixtures), ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Run("Clears and inserts the collections", func(t *testing.T) {
+		count, _ := dogs.Count(bson.M{}, ctx)
+		if count != 2 {
+			t.Errorf("Expected 2 dogs, got %d", count)
+		}
+	})
+	t.Run("Returns models by fixture name", func(t *testing.T) {
+		fido, err := bark.Fixture[*Dog](fixtures, "fido")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if fido.Name != "Fido" || fido.Age != 3 || fido.Version != 1 || !fido.CreatedOn.Equal(bark.Now(ctx)) {
+			t.Errorf("Expected Fido at version 1, got %s at version %d", fido.String(), fido.Version)
+		}
+		stored, err := dogs.Get(fido.Id, ctx)
+		if err != nil || stored.Name != "Fido" {
+			t.Errorf("Expected Fido to be stored, got %v and %v", stored, err)
+		}
+		if _, err := bark.Fixture[*Dog](fixtures, "rex"); !errors.Is(err, bark.ErrUnknownFixture) {
+			t.Errorf("Expected ErrUnknownFixture, got %v", err)
+		}
+	})
+	t.Run("Resolves references and times", func(t *testing.T) {
+		fido, _ := fixtures.Doc("fido")
+		if fido["OwnerId"] != fixtures.Id("alice") {
+			t.Errorf("Expected OwnerId %s, got %v", fixtures.Id("alice"), fido["OwnerId"])
+		}
+		if born, _ := fido["BornOn"].(time.Time); !born.Equal(bark.Now(ctx).Add(-72 * time.Hour)) {
+			t.Errorf("Expected BornOn 3 days ago, got %v", fido["BornOn"])
+		}
+		want := "Owned by " + fixtures.Id("alice") + " since 2024-03-26T19:55:38Z"
+		if fido["Note"] != want {
+			t.Errorf("Expected %q, got %q", want, fido["Note"])
+		}
+	})
+	t.Run("Gives deterministic ids", func(t *testing.T) {
+		if fixtures.Id("spot") != "2222" {
+			t.Errorf("Expected the explicit id, got %s", fixtures.Id("spot"))
+		}
+		again, _ := bark.LoadFixtures([]byte(dogFixtures), ctx)
+		if again.Id("fido") != fixtures.Id("fido") || len(fixtures.Id("fido")) != 16 {
+			t.Errorf("Expected the same 16 character id, got %s and %s", fixtures.Id("fido"), again.Id("fido"))
+		}
+		seqCtx := bark.WithIDGenerator(ctx, bark.NewSequentialIDGenerator(0))
+		sequential, _ := bark.LoadFixtures([]byte(dogFixtures), seqCtx)
+		if sequential.Id("alice") != "0000000000000001" || sequential.Id("fido") != "0000000000000002" {
+			t.Errorf("Expected ids from the context generator in file order, got %s and %s", sequential.Id("alice"), sequential.Id("fido"))
+		}
+	})
+	t.Run("Loads JSON files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dogs.json")
+		os.WriteFile(path, []byte(`{"dogs": {"rex": {"Name": "Rex", "Age": 7}}}`), 0o644)
+		fixtures, err := bark.LoadFixtureFile(path, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		rex, _ := bark.Fixture[*Dog](fixtures, "rex")
+		if rex.Name != "Rex" || rex.Age != 7 {
+			t.Errorf("Expected Rex, got %s", rex.String())
+		}
+	})
+	t.Run("Fails on unknown references", func(t *testing.T) {
+		_, err := bark.LoadFixtures([]byte(`dogs: {fido: {OwnerId: "{{ref bob}}"}}`), ctx)
+		if !errors.Is(err, bark.ErrUnknownFixture) {
+			t.Errorf("Expected ErrUnknownFixture, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var ErrNoGeoField = errors.New("model needs exactly one field tagged `bark:\"2dsphere\"`")
+
+// A GeoJSON point, embed it in a model and tag it `bark:"2dsphere"` to index it
+type Point struct {
+	Type string `json:"type" bson:"type"`
+	// Longitude then latitude
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// Creates a point, note that GeoJSON puts the longitude first
+func NewPoint(lng float64, lat float64) Point {
+	return Point{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// Returns the longitude of the point
+func (p Point) Lng() float64 {
+	if len(p.Coordinates) < 1 {
+		return 0
+	}
+	return p.Coordinates[0]
+}
+
+// Returns the latitude of the point
+func (p Point) Lat() float64 {
+	if len(p.Coordinates) < 2 {
+		return 0
+	}
+	return p.Coordinates[1]
+}
+
+// A GeoJSON polygon, the first ring is its outline and any others are holes
+type Polygon struct {
+	Type        string        `json:"type" bson:"type"`
+	Coordinates [][][]float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// Creates a polygon outlined by the points, closing the ring if the last point isn't the first
+func NewPolygon(points ...Point) Polygon {
+	ring := make([][]float64, 0, len(points)+1)
+	for _, p := range points {
+		ring = append(ring, []float64{p.Lng(), p.Lat()})
+	}
+	if len(points) > 0 {
+		first, last := points[0], points[len(points)-1]
+		if first.Lng() != last.Lng() || first.Lat() != last.Lat() {
+			ring = append(ring, []float64{first.Lng(), first.Lat()})
+		}
+	}
+	return Polygon{Type: "Polygon", Coordinates: [][][]float64{ring}}
+}
+
+// Creates a 2dsphere index on each of the model's fields tagged `bark:"2dsphere"` and returns their names
+func (c *Collection[T]) EnsureGeoIndexes(ctx context.Context) ([]string, error) {
+	fields := taggedFields(reflect.TypeFor[T](), "2dsphere")
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoGeoField, reflect.TypeFor[T]())
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to create geo index on: %w", err)
+	}
+	var names []string
+	for _, field := range fields {
+		name, err := backend.CreateIndex(ctx, bson.D{{Key: field.key, Value: "2dsphere"}}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating geo index on %s: %w", field.key, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Returns the key of the model's only field tagged `bark:"2dsphere"`
+func (c *Collection[T]) geoField() (string, error) {
+	fields := taggedFields(reflect.TypeFor[T](), "2dsphere")
+	if len(fields) != 1 {
+		return "", fmt.Errorf("%w: %s has %d", ErrNoGeoField, reflect.TypeFor[T](), len(fields))
+	}
+	return fields[0].key, nil
+}
+
+// Returns the documents matching the filter within maxDistance meters of the point, nearest first
+// A maxDistance of 0 means no limit
+// Uses the model's field tagged `bark:"2dsphere"`, which needs a 2dsphere index, see EnsureGeoIndexes
+func (c *Collection[T]) Near(point Point, maxDistance float64, filter bson.M, ctx context.Context) ([]T, error) {
+	field, err := c.geoField()
+	if err != nil {
+		return nil, err
+	}
+	near := bson.M{"$geometry": point}
+	if maxDistance > 0 {
+		near["$maxDistance"] = maxDistance
+	}
+	return c.Find(withCondition(filter, field, bson.M{"$near": near}), nil, ctx)
+}
+
+// Returns the documents matching the filter whose location is inside the polygon
+// Uses the model's field tagged `bark:"2dsphere"`
+func (c *Collection[T]) Within(polygon Polygon, filter bson.M, ctx context.Context) ([]T, error) {
+	field, err := c.geoField()
+	if err != nil {
+		return nil, err
+	}
+	return c.Find(withCondition(filter, field, bson.M{"$geoWithin": bson.M{"$geometry": polygon}}), nil, ctx)
+}
+
+// Returns a copy of the filter with the condition on the field added
+func withCondition(filter bson.M, field string, condition bson.M) bson.M {
+	combined := bson.M{}
+	for key, value := range filter {
+		combined[key] = value
+	}
+	if _, ok := combined[field]; ok {
+		return bson.M{"$and": bson.A{combined, bson.M{field: condition}}}
+	}
+	combined[field] = condition
+	return combined
+}
+
+// Options for Collection.GeoNear
+type GeoNearOptions struct {
+	// Only documents matching the filter are considered
+	Filter bson.M
+	// Distances in meters, 0 for no limit
+	MinDistance float64
+	MaxDistance float64
+	// Largest number of results, 0 for no limit
+	Limit int64
+}
+
+// A document found by GeoNear with its distance in meters
+type GeoResult[T any] struct {
+	Doc      T
+	Distance float64
+}
+
+// The key $geoNear puts the distance in
+const distanceKey = "_barkDistance"
+
+// Returns the documents nearest the point with their distances, using a $geoNear aggregation
+// Uses the model's field tagged `bark:"2dsphere"`
+func (c *Collection[T]) GeoNear(point Point, opts *GeoNearOptions, ctx context.Context) ([]GeoResult[T], error) {
+	if opts == nil {
+		opts = &GeoNearOptions{}
+	}
+	field, err := c.geoField()
+	if err != nil {
+		return nil, err
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to search near: %w", err)
+	}
+	geoNear := bson.D{
+		{Key: "near", Value: point},
+		{Key: "distanceField", Value: distanceKey},
+		{Key: "key", Value: field},
+		{Key: "spherical", Value: true},
+	}
+	if len(opts.Filter) > 0 {
+		geoNear = append(geoNear, bson.E{Key: "query", Value: opts.Filter})
+	}
+	if opts.MinDistance > 0 {
+		geoNear = append(geoNear, bson.E{Key: "minDistance", Value: opts.MinDistance})
+	}
+	if opts.MaxDistance > 0 {
+		geoNear = append(geoNear, bson.E{Key: "maxDistance", Value: opts.MaxDistance})
+	}
+	pipeline := bson.A{bson.D{{Key: "$geoNear", Value: geoNear}}}
+	if opts.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: opts.Limit}})
+	}
+	cursor, err := backend.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error searching near: %w", err)
+	}
+	defer cursor.Close(ctx)
+	var results []GeoResult[T]
+	for cursor.Next(ctx) {
+		raw, extra, err := splitDocument(cursor.Current(), func(key string) bool { return key == distanceKey })
+		if err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		var result GeoResult[T]
+		result.Distance, _ = toFloat(extra[distanceKey])
+		if err := c.decode(backend, raw, &result.Doc, ctx); err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		result.Doc.SetCollectionName(c.Name)
+		results = append(results, result)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error searching near: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,87 @@
+package bark_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Park struct {
+	bark.Model `bson:",inline"`
+	Name       string     `bson:"Name"`
+	Kind       string     `bson:"Kind"`
+	Location   bark.Point `bson:"Location" bark:"2dsphere"`
+}
+
+func parkNames(parks []*Park) []string {
+	var names []string
+	for _, park := range parks {
+		names = append(names, park.Name)
+	}
+	return names
+}
+
+func TestGeo(t *testing.T) {
+	db := bark.NewMemoryDb()
+	ctx := bark.WithMemoryDb(setupTest("Geo", "2024-03-27T19:55:38.782Z", t), db)
+	insertAll("parks", ctx, t,
+		bson.M{"_id": "p1", "Name": "Near", "Kind": "dog", "Location": bark.NewPoint(0.001, 0)},
+		bson.M{"_id": "p2", "Name": "Middle", "Kind": "city", "Location": bark.NewPoint(0.01, 0)},
+		bson.M{"_id": "p3", "Name": "Far", "Kind": "dog", "Location": bark.NewPoint(1, 1)})
+	parks := bark.NewCollection[*Park]("parks")
+	origin := bark.NewPoint(0, 0)
+
+	t.Run("Creates 2dsphere indexes", func(t *testing.T) {
+		names, err := parks.EnsureGeoIndexes(ctx)
+		if err != nil || len(names) != 1 {
+			t.Fatalf("Expected one index, got %v and %v", names, err)
+		}
+		if keys := db.Indexes("parks")[names[0]]; len(keys) != 1 || keys[0] != (bson.E{Key: "Location", Value: "2dsphere"}) {
+			t.Errorf("Expected a 2dsphere index on Location, got %v", keys)
+		}
+		if _, err := bark.NewCollection[*Dog](DogCollectionName).Near(origin, 0, nil, ctx); err == nil {
+			t.Error("Expected an error for a model without a geo field")
+		}
+	})
+	t.Run("Near sorts by distance", func(t *testing.T) {
+		results, err := parks.Near(origin, 5000, nil, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := parkNames(results); len(got) != 2 || got[0] != "Near" || got[1] != "Middle" {
+			t.Errorf("Expected Near then Middle, got %v", got)
+		}
+		results, _ = parks.Near(origin, 0, bson.M{"Kind": "dog"}, ctx)
+		if got := parkNames(results); len(got) != 2 || got[0] != "Near" || got[1] != "Far" {
+			t.Errorf("Expected the dog parks nearest first, got %v", got)
+		}
+	})
+	t.Run("Within a polygon", func(t *testing.T) {
+		square := bark.NewPolygon(bark.NewPoint(-0.005, -0.005), bark.NewPoint(0.005, -0.005), bark.NewPoint(0.005, 0.005), bark.NewPoint(-0.005, 0.005))
+		if len(square.Coordinates[0]) != 5 {
+			t.Errorf("Expected the ring to be closed, got %v", square.Coordinates)
+		}
+		results, err := parks.Within(square, nil, ctx)
+		if got := parkNames(results); err != nil || len(got) != 1 || got[0] != "Near" {
+			t.Errorf("Expected only Near, got %v and %v", got, err)
+		}
+	})
+	t.Run("GeoNear returns distances", func(t *testing.T) {
+		results, err := parks.GeoNear(origin, &bark.GeoNearOptions{MinDistance: 500, Limit: 2}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 2 || results[0].Doc.Name != "Middle" || results[1].Doc.Name != "Far" {
+			t.Fatalf("Expected Middle then Far, got %v", results)
+		}
+		// 0.01 degrees of longitude at the equator is about 1113 meters
+		if math.Abs(results[0].Distance-1113) > 5 {
+			t.Errorf("Expected about 1113 meters, got %v", results[0].Distance)
+		}
+		if results[0].Doc.Location.Lng() != 0.01 {
+			t.Errorf("Expected the location to be decoded, got %v", results[0].Doc.Location)
+		}
+	})
+}
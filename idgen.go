@@ -0,0 +1,196 @@
+package bark
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const IDGeneratorKey Key = "idGenerator"
+
+// Generates the ids given to new models
+type IDGenerator interface {
+	NewID() string
+}
+
+// Adapts a function to the IDGenerator interface
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+var idGeneratorMu sync.RWMutex
+
+// Uuid is the default to keep the sequential ids it gives in test mode
+var idGenerator IDGenerator = IDGeneratorFunc(func() string { return Uuid() })
+
+// Sets the generator used by collections that don't have their own, nil restores the default
+func SetIDGenerator(gen IDGenerator) {
+	if gen == nil {
+		gen = IDGeneratorFunc(func() string { return Uuid() })
+	}
+	idGeneratorMu.Lock()
+	defer idGeneratorMu.Unlock()
+	idGenerator = gen
+}
+
+// Returns the generator used by collections that don't have their own
+func DefaultIDGenerator() IDGenerator {
+	idGeneratorMu.RLock()
+	defer idGeneratorMu.RUnlock()
+	return idGenerator
+}
+
+// Sets the generator for new models saved to the collection, nil uses the global generator
+func (c *Collection[T]) SetIDGenerator(gen IDGenerator) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.idGenerator = gen
+	return c
+}
+
+// Returns a context whose generator is used for new models ahead of any collection or global generator
+func WithIDGenerator(ctx context.Context, gen IDGenerator) context.Context {
+	return context.WithValue(ctx, IDGeneratorKey, gen)
+}
+
+// Returns a new id from the generator in the context, the collection's generator or the global one
+func (c *Collection[T]) NewID(ctx context.Context) string {
+	if gen, ok := ctx.Value(IDGeneratorKey).(IDGenerator); ok && gen != nil {
+		return gen.NewID()
+	}
+	cfg := configFor(c.Name)
+	cfg.mu.RLock()
+	gen := cfg.idGenerator
+	cfg.mu.RUnlock()
+	if gen == nil {
+		gen = DefaultIDGenerator()
+	}
+	return gen.NewID()
+}
+
+// Returns a generator of random version 4 UUIDs
+func UUIDv4() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var b [16]byte
+		rand.Read(b[:])
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return formatUUID(b)
+	})
+}
+
+// Returns a generator of version 7 UUIDs, which sort by the millisecond they were created in
+func UUIDv7() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var b [16]byte
+		rand.Read(b[6:])
+		putMillis(b[:6], time.Now())
+		b[6] = b[6]&0x0f | 0x70
+		b[8] = b[8]&0x3f | 0x80
+		return formatUUID(b)
+	})
+}
+
+// Returns a generator of ULIDs, 26 character ids that sort by the millisecond they were created in
+func ULID() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var b [16]byte
+		rand.Read(b[6:])
+		putMillis(b[:6], time.Now())
+		return encodeCrockford(b)
+	})
+}
+
+// Returns a generator of MongoDB ObjectIDs as hex strings
+func ObjectIDHex() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		return bson.NewObjectID().Hex()
+	})
+}
+
+// Returns a generator that prefixes the ids of another, e.g. Prefixed("dog", ULID()) gives "dog_01H..."
+func Prefixed(prefix string, gen IDGenerator) IDGenerator {
+	return IDGeneratorFunc(func() string {
+		return prefix + "_" + gen.NewID()
+	})
+}
+
+// Generates zero padded sequential ids, for deterministic ids in tests
+// Safe to share between goroutines, but give each parallel test its own to keep their ids independent
+type SequentialIDGenerator struct {
+	mu     sync.Mutex
+	seed   int64
+	last   int64
+	length int
+}
+
+// Creates a sequential generator whose first id is seed+1
+// length is optional and defaults to the length of Uuid
+func NewSequentialIDGenerator(seed int64, length ...int) *SequentialIDGenerator {
+	l := tokenLength
+	if len(length) > 0 {
+		l = length[0]
+	}
+	return &SequentialIDGenerator{seed: seed, last: seed, length: l}
+}
+
+// Returns the next id in the sequence
+func (g *SequentialIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last++
+	return fmt.Sprintf("%0*d", g.length, g.last)
+}
+
+// Restarts the sequence from the seed
+func (g *SequentialIDGenerator) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last = g.seed
+}
+
+// Formats the bytes in the canonical 8-4-4-4-12 form
+func formatUUID(b [16]byte) string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf)
+}
+
+// Writes the unix milliseconds of the time as a 48 bit big endian number
+func putMillis(b []byte, t time.Time) {
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(b, ms[2:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Encodes the 128 bits as 26 Crockford base32 characters, most significant first
+func encodeCrockford(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
@@ -0,0 +1,126 @@
+package bark_test
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+)
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		name    string
+		gen     bark.IDGenerator
+		pattern string
+	}{
+		{"UUIDv4", bark.UUIDv4(), `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"UUIDv7", bark.UUIDv7(), `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"ULID", bark.ULID(), `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"ObjectIDHex", bark.ObjectIDHex(), `^[0-9a-f]{24}$`},
+		{"Prefixed", bark.Prefixed("dog", bark.ULID()), `^dog_[0-9A-HJKMNP-TV-Z]{26}$`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pattern := regexp.MustCompile(test.pattern)
+			first, second := test.gen.NewID(), test.gen.NewID()
+			if !pattern.MatchString(first) {
+				t.Errorf("Expected %s to match %s", first, test.pattern)
+			}
+			if first == second {
+				t.Errorf("Expected unique ids, got %s twice", first)
+			}
+		})
+	}
+	t.Run("Time based ids sort by creation time", func(t *testing.T) {
+		for _, gen := range []bark.IDGenerator{bark.UUIDv7(), bark.ULID()} {
+			var ids []string
+			for i := 0; i < 3; i++ {
+				ids = append(ids, gen.NewID())
+				time.Sleep(2 * time.Millisecond)
+			}
+			if !sort.StringsAreSorted(ids) {
+				t.Errorf("Expected ids to be sorted, got %v", ids)
+			}
+		}
+	})
+}
+func TestCollectionIDGenerator(t *testing.T) {
+	ctx := setupMemoryTest("CollectionIDGenerator", "2024-03-27T19:55:38.782Z", t)
+	bark.NewCollection[*Dog](DogCollectionName).SetIDGenerator(bark.Prefixed("dog", bark.ObjectIDHex()))
+	defer bark.NewCollection[*Dog](DogCollectionName).SetIDGenerator(nil)
+
+	fido := NewDog("Fido")
+	if _, err := fido.Save(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(fido.Id, "dog_") || len(fido.Id) != 28 {
+		t.Errorf("Expected a prefixed ObjectID, got %s", fido.Id)
+	}
+	t.Run("Other collections use the global generator", func(t *testing.T) {
+		bark.SetIDGenerator(bark.Prefixed("any", bark.UUIDv4()))
+		defer bark.SetIDGenerator(nil)
+		if id := bark.NewCollection[*Dog]("cats").NewID(ctx); !strings.HasPrefix(id, "any_") {
+			t.Errorf("Expected the global generator to be used, got %s", id)
+		}
+		if id := bark.NewCollection[*Dog](DogCollectionName).NewID(ctx); !strings.HasPrefix(id, "dog_") {
+			t.Errorf("Expected the collection generator to win, got %s", id)
+		}
+	})
+}
+func TestSequentialIDGenerator(t *testing.T) {
+	t.Run("Starts after the seed and resets", func(t *testing.T) {
+		gen := bark.NewSequentialIDGenerator(100, 6)
+		if id := gen.NewID(); id != "000101" {
+			t.Errorf("Expected 000101, got %s", id)
+		}
+		gen.NewID()
+		gen.Reset()
+		if id := gen.NewID(); id != "000101" {
+			t.Errorf("Expected 000101 after reset, got %s", id)
+		}
+	})
+	t.Run("Is safe to share between goroutines", func(t *testing.T) {
+		gen := bark.NewSequentialIDGenerator(0)
+		ids := make(chan string, 100)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ids <- gen.NewID()
+			}()
+		}
+		wg.Wait()
+		close(ids)
+		seen := map[string]bool{}
+		for id := range ids {
+			seen[id] = true
+		}
+		if len(seen) != 100 {
+			t.Errorf("Expected 100 unique ids, got %d", len(seen))
+		}
+	})
+	for _, name := range []string{"Fido", "Spot"} {
+		t.Run("SaveModel uses the context generator for "+name, func(t *testing.T) {
+			t.Parallel()
+			// setupTest sets environment variables, which parallel tests can't do
+			ctx := context.WithValue(context.Background(), bark.DbNameKey, "test-SequentialIDGenerator"+name)
+			ctx = bark.WithMemoryDb(ctx, bark.NewMemoryDb())
+			ctx = bark.WithIDGenerator(ctx, bark.NewSequentialIDGenerator(0))
+			for _, want := range []string{"0000000000000001", "0000000000000002"} {
+				dog := NewDog(name)
+				if _, err := dog.Save(ctx); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if dog.Id != want {
+					t.Errorf("Expected id %s, got %s", want, dog.Id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package bark
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Describes a single backend call while it passes through the interceptors
+type Operation struct {
+	Database   string
+	Collection string
+	// The Backend method being called, e.g. "Find" or "UpdateOne"
+	Name   string
+	Filter any
+	// The cursor returned by Find or Aggregate, interceptors may wrap it after the call
+	Cursor Cursor
+	// True for a Find with a tailable cursor, which waits for new documents instead of running out
+	Tailable bool
+	// The number of documents found, counted or written, set after the call
+	Documents int64
+}
+
+// Runs around every backend call, next performs the call
+type interceptor func(ctx context.Context, op *Operation, next func(ctx context.Context) error) error
+
+// Returns the interceptors that apply to calls on the collection made with this context
+// Telemetry comes first so a span covers the whole call, the circuit breaker sees each call once
+// however often it is retried, and faults come last so they can be retried
+func interceptorsFor(collection string, ctx context.Context) []interceptor {
+	var interceptors []interceptor
+	if t := telemetryState.Load(); t != nil {
+		interceptors = append(interceptors, t.intercept)
+	}
+	if dbName, ok := ctx.Value(DbNameKey).(string); ok {
+		if breaker := CircuitBreakerFor(dbName); breaker != nil {
+			interceptors = append(interceptors, breaker.intercept)
+		}
+	}
+	cfg := configFor(collection)
+	if timeouts := cfg.effectiveTimeouts(); timeouts != (Timeouts{}) {
+		interceptors = append(interceptors, timeouts.intercept)
+	}
+	if policy := cfg.effectiveRetryPolicy(); policy != nil && policy.MaxAttempts > 1 {
+		interceptors = append(interceptors, policy.intercept)
+	}
+	if cache := cfg.currentCache(); cache != nil {
+		interceptors = append(interceptors, cache.intercept)
+	}
+	if faults, ok := ctx.Value(FaultsKey).(*Faults); ok && faults != nil {
+		interceptors = append(interceptors, faults.intercept)
+	}
+	return interceptors
+}
+
+// Wraps the backend so its calls run through the interceptors for the context
+func intercept(backend Backend, collection string, ctx context.Context) Backend {
+	interceptors := interceptorsFor(collection, ctx)
+	if len(interceptors) == 0 {
+		return backend
+	}
+	database, _ := ctx.Value(DbNameKey).(string)
+	return &interceptedBackend{inner: backend, database: database, collection: collection, interceptors: interceptors}
+}
+
+// A backend whose calls run through a chain of interceptors, the first one outermost
+type interceptedBackend struct {
+	inner        Backend
+	database     string
+	collection   string
+	interceptors []interceptor
+}
+
+// Runs the call through the interceptors
+func (b *interceptedBackend) run(ctx context.Context, op *Operation, call func(ctx context.Context) error) error {
+	op.Database = b.database
+	op.Collection = b.collection
+	next := call
+	for i := len(b.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := b.interceptors[i], next
+		next = func(ctx context.Context) error {
+			return interceptor(ctx, op, inner)
+		}
+	}
+	return next(ctx)
+}
+
+func (b *interceptedBackend) Find(ctx context.Context, filter any, opts *options.FindOptionsBuilder) (Cursor, error) {
+	op := &Operation{Name: "Find", Filter: filter}
+	if findOpts, err := resolveOptions[options.FindOptions](opts); err == nil && findOpts.CursorType != nil {
+		op.Tailable = *findOpts.CursorType != options.NonTailable
+	}
+	err := b.run(ctx, op, func(ctx context.Context) error {
+		cursor, err := b.inner.Find(ctx, filter, opts)
+		op.Cursor = cursor
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return op.Cursor, nil
+}
+
+func (b *interceptedBackend) FindOne(ctx context.Context, filter any, opts *options.FindOneOptionsBuilder) (raw bson.Raw, err error) {
+	op := &Operation{Name: "FindOne", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		raw, err = b.inner.FindOne(ctx, filter, opts)
+		if err == nil {
+			op.Documents = 1
+		}
+		return err
+	})
+	return raw, err
+}
+
+func (b *interceptedBackend) CountDocuments(ctx context.Context, filter any) (count int64, err error) {
+	op := &Operation{Name: "CountDocuments", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		count, err = b.inner.CountDocuments(ctx, filter)
+		op.Documents = count
+		return err
+	})
+	return count, err
+}
+
+func (b *interceptedBackend) InsertOne(ctx context.Context, document any) (res *mongo.InsertOneResult, err error) {
+	op := &Operation{Name: "InsertOne"}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.InsertOne(ctx, document)
+		if err == nil {
+			op.Documents = 1
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) InsertMany(ctx context.Context, documents []any) (res *mongo.InsertManyResult, err error) {
+	op := &Operation{Name: "InsertMany"}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.InsertMany(ctx, documents)
+		if res != nil {
+			op.Documents = int64(len(res.InsertedIDs))
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) UpdateOne(ctx context.Context, filter any, update any, opts *options.UpdateOneOptionsBuilder) (res *mongo.UpdateResult, err error) {
+	op := &Operation{Name: "UpdateOne", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.UpdateOne(ctx, filter, update, opts)
+		if res != nil {
+			op.Documents = res.ModifiedCount + res.UpsertedCount
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) UpdateMany(ctx context.Context, filter any, update any, opts *options.UpdateManyOptionsBuilder) (res *mongo.UpdateResult, err error) {
+	op := &Operation{Name: "UpdateMany", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.UpdateMany(ctx, filter, update, opts)
+		if res != nil {
+			op.Documents = res.ModifiedCount + res.UpsertedCount
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) ReplaceOne(ctx context.Context, filter any, replacement any, opts *options.ReplaceOptionsBuilder) (res *mongo.UpdateResult, err error) {
+	op := &Operation{Name: "ReplaceOne", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.ReplaceOne(ctx, filter, replacement, opts)
+		if res != nil {
+			op.Documents = res.ModifiedCount + res.UpsertedCount
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) DeleteOne(ctx context.Context, filter any) (res *mongo.DeleteResult, err error) {
+	op := &Operation{Name: "DeleteOne", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.DeleteOne(ctx, filter)
+		if res != nil {
+			op.Documents = res.DeletedCount
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) DeleteMany(ctx context.Context, filter any) (res *mongo.DeleteResult, err error) {
+	op := &Operation{Name: "DeleteMany", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		res, err = b.inner.DeleteMany(ctx, filter)
+		if res != nil {
+			op.Documents = res.DeletedCount
+		}
+		return err
+	})
+	return res, err
+}
+
+func (b *interceptedBackend) Aggregate(ctx context.Context, pipeline any) (Cursor, error) {
+	op := &Operation{Name: "Aggregate", Filter: pipeline}
+	err := b.run(ctx, op, func(ctx context.Context) error {
+		cursor, err := b.inner.Aggregate(ctx, pipeline)
+		op.Cursor = cursor
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return op.Cursor, nil
+}
+
+func (b *interceptedBackend) Distinct(ctx context.Context, fieldName string, filter any) (values bson.RawArray, err error) {
+	op := &Operation{Name: "Distinct", Filter: filter}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		values, err = b.inner.Distinct(ctx, fieldName, filter)
+		if err == nil {
+			elems, _ := values.Values()
+			op.Documents = int64(len(elems))
+		}
+		return err
+	})
+	return values, err
+}
+
+func (b *interceptedBackend) CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptionsBuilder) (name string, err error) {
+	op := &Operation{Name: "CreateIndex"}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		name, err = b.inner.CreateIndex(ctx, keys, opts)
+		return err
+	})
+	return name, err
+}
+
+func (b *interceptedBackend) CreateCollection(ctx context.Context, opts *options.CreateCollectionOptionsBuilder) error {
+	op := &Operation{Name: "CreateCollection"}
+	return b.run(ctx, op, func(ctx context.Context) error {
+		return b.inner.CreateCollection(ctx, opts)
+	})
+}
+
+func (b *interceptedBackend) Specification(ctx context.Context) (spec *mongo.CollectionSpecification, err error) {
+	op := &Operation{Name: "Specification"}
+	err = b.run(ctx, op, func(ctx context.Context) error {
+		spec, err = b.inner.Specification(ctx)
+		return err
+	})
+	return spec, err
+}
+
+func (b *interceptedBackend) ModifyCollection(ctx context.Context, changes bson.D) error {
+	op := &Operation{Name: "ModifyCollection"}
+	return b.run(ctx, op, func(ctx context.Context) error {
+		return b.inner.ModifyCollection(ctx, changes)
+	})
+}
@@ -0,0 +1,186 @@
+package bark
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Options for a Loader, zero fields use the defaults
+type LoaderOptions struct {
+	// How long to wait for more ids before fetching a batch, defaults to 1ms
+	Wait time.Duration
+	// Largest number of ids fetched at once, defaults to 100
+	MaxBatch int
+	// How long fetching a batch may take, defaults to the collection's read timeout
+	Timeout time.Duration
+}
+
+// Batches Get calls on a collection into single $in queries
+// A loader belongs to one request: it remembers what it has loaded, so it never sees later changes
+type Loader[T ModelWithCollection] struct {
+	collection *Collection[T]
+	opts       LoaderOptions
+	mu         sync.Mutex
+	// The batch each id was loaded in, including batches still waiting or being fetched
+	batches map[string]*loaderBatch[T]
+	batch   *loaderBatch[T]
+}
+
+// The outcome of loading one id
+type loaderResult[T ModelWithCollection] struct {
+	obj T
+	err error
+}
+
+// Ids waiting to be fetched together, done is closed once results is filled in
+type loaderBatch[T ModelWithCollection] struct {
+	ids     []string
+	ctx     context.Context
+	done    chan struct{}
+	results map[string]*loaderResult[T]
+}
+
+// Creates a loader for the collection
+func NewLoader[T ModelWithCollection](collection *Collection[T], opts *LoaderOptions) *Loader[T] {
+	l := &Loader[T]{collection: collection, batches: make(map[string]*loaderBatch[T])}
+	if opts != nil {
+		l.opts = *opts
+	}
+	if l.opts.Wait <= 0 {
+		l.opts.Wait = time.Millisecond
+	}
+	if l.opts.MaxBatch <= 0 {
+		l.opts.MaxBatch = 100
+	}
+	return l
+}
+
+// Returns the context key for the loader of the named collection
+func loaderKey(collection string) Key {
+	return Key("loader:" + collection)
+}
+
+// Returns a context whose Get calls on the loader's collection go through the loader
+func WithLoader[T ModelWithCollection](ctx context.Context, loader *Loader[T]) context.Context {
+	return context.WithValue(ctx, loaderKey(loader.collection.Name), loader)
+}
+
+// Returns the loader for the collection in the context, or nil if there isn't one
+func loaderFrom[T ModelWithCollection](name string, ctx context.Context) *Loader[T] {
+	loader, _ := ctx.Value(loaderKey(name)).(*Loader[T])
+	return loader
+}
+
+// Returns the model with the id, fetched together with the other ids requested at about the same time
+// Returns ErrNotFound if there is no such model
+// The batch is fetched with the values of the context of the call that started it, but not its deadline or cancellation,
+// since other calls wait for it too, each call stops waiting when its own context is done
+func (l *Loader[T]) Load(id string, ctx context.Context) (T, error) {
+	l.mu.Lock()
+	batch, ok := l.batches[id]
+	full := false
+	if !ok {
+		batch = l.batch
+		if batch == nil {
+			batch = &loaderBatch[T]{ctx: ctx, done: make(chan struct{})}
+			l.batch = batch
+			time.AfterFunc(l.opts.Wait, func() { l.dispatch(batch) })
+		}
+		batch.ids = append(batch.ids, id)
+		l.batches[id] = batch
+		full = len(batch.ids) >= l.opts.MaxBatch
+	}
+	l.mu.Unlock()
+	if full {
+		l.dispatch(batch)
+	}
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return *new(T), ctx.Err()
+	}
+	result := batch.results[id]
+	return result.obj, result.err
+}
+
+// Returns the models with the ids in the same order, with ErrNotFound for the ids that don't exist
+func (l *Loader[T]) LoadMany(ids []string, ctx context.Context) ([]T, []error) {
+	objs := make([]T, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			objs[i], errs[i] = l.Load(id, ctx)
+		}()
+	}
+	wg.Wait()
+	return objs, errs
+}
+
+// Forgets everything the loader has loaded
+func (l *Loader[T]) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.batches = make(map[string]*loaderBatch[T])
+}
+
+// Fetches the batch unless it has already been fetched
+func (l *Loader[T]) dispatch(batch *loaderBatch[T]) {
+	l.mu.Lock()
+	if l.batch != batch {
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	ids := batch.ids
+	l.mu.Unlock()
+
+	ctx := context.WithoutCancel(batch.ctx)
+	if l.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.opts.Timeout)
+		defer cancel()
+	}
+	results := make(map[string]*loaderResult[T], len(ids))
+	objs, err := l.collection.Find(bson.M{"Id": bson.M{"$in": ids}}, nil, ctx)
+	for _, obj := range objs {
+		results[modelId(obj)] = &loaderResult[T]{obj: obj}
+	}
+	for _, id := range ids {
+		if err != nil {
+			results[id] = &loaderResult[T]{err: err}
+		} else if _, ok := results[id]; !ok {
+			results[id] = &loaderResult[T]{err: ErrNotFound}
+		}
+	}
+	if err != nil {
+		// Failed loads aren't remembered so the ids can be loaded again
+		l.mu.Lock()
+		for _, id := range ids {
+			if l.batches[id] == batch {
+				delete(l.batches, id)
+			}
+		}
+		l.mu.Unlock()
+	}
+	batch.results = results
+	close(batch.done)
+}
+
+// Returns the Id of a model, from GetId if it has one
+func modelId(obj any) string {
+	if model, ok := obj.(interface{ GetId() string }); ok {
+		return model.GetId()
+	}
+	data, err := bson.Marshal(obj)
+	if err != nil {
+		return ""
+	}
+	id, _ := bson.Raw(data).Lookup("Id").StringValueOK()
+	return id
+}
@@ -0,0 +1,97 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+)
+
+func TestLoader(t *testing.T) {
+	ctx := setupMemoryTest("Loader", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{
+		{Name: "Fido", Id: "1111"},
+		{Name: "Spot", Id: "2222"},
+		{Name: "Rex", Id: "3333"},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+
+	t.Run("Batches concurrent Gets into one query", func(t *testing.T) {
+		faults := bark.NewFaults()
+		loaderCtx := bark.WithLoader(bark.WithFaults(ctx, faults), bark.NewLoader(dogs, nil))
+		names := make([]string, 4)
+		var wg sync.WaitGroup
+		for i, id := range []string{"1111", "2222", "1111", "3333"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dog, err := dogs.Get(id, loaderCtx)
+				if err != nil {
+					t.Errorf("Expected no error for %s, got %v", id, err)
+					return
+				}
+				names[i] = dog.Name
+			}()
+		}
+		wg.Wait()
+		if names[0] != "Fido" || names[1] != "Spot" || names[2] != "Fido" || names[3] != "Rex" {
+			t.Errorf("Expected each Get to get its own dog, got %v", names)
+		}
+		if calls := faults.Calls(DogCollectionName, ""); calls != 1 {
+			t.Errorf("Expected 1 query, got %d", calls)
+		}
+		dogs.Get("2222", loaderCtx)
+		if calls := faults.Calls(DogCollectionName, ""); calls != 1 {
+			t.Errorf("Expected loaded dogs to be remembered, got %d queries", calls)
+		}
+	})
+	t.Run("LoadMany keeps the order and reports missing ids", func(t *testing.T) {
+		loader := bark.NewLoader(dogs, &bark.LoaderOptions{MaxBatch: 2})
+		results, errs := loader.LoadMany([]string{"3333", "9999", "1111"}, ctx)
+		if results[0].Name != "Rex" || results[2].Name != "Fido" {
+			t.Errorf("Expected Rex and Fido in order, got %v", results)
+		}
+		if errs[0] != nil || errs[1] != bark.ErrNotFound || errs[2] != nil {
+			t.Errorf("Expected ErrNotFound only for the missing id, got %v", errs)
+		}
+	})
+	t.Run("Doesn't remember failed loads", func(t *testing.T) {
+		loader := bark.NewLoader(dogs, nil)
+		failing := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "Find", Err: bark.TransientError()}))
+		if _, err := loader.Load("1111", failing); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if dog, err := loader.Load("1111", ctx); err != nil || dog.Name != "Fido" {
+			t.Errorf("Expected Fido on the second try, got %v and %v", dog, err)
+		}
+	})
+	t.Run("Fetches the batch even if the call that started it gives up", func(t *testing.T) {
+		loader := bark.NewLoader(dogs, &bark.LoaderOptions{Wait: 50 * time.Millisecond})
+		canceled, cancel := context.WithCancel(ctx)
+		started := make(chan error)
+		go func() {
+			_, err := loader.Load("1111", canceled)
+			started <- err
+		}()
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+		if err := <-started; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the first call to stop waiting, got %v", err)
+		}
+		if dog, err := loader.Load("2222", ctx); err != nil || dog.Name != "Spot" {
+			t.Errorf("Expected Spot from the same batch, got %v and %v", dog, err)
+		}
+	})
+	t.Run("Gives up on a batch after the timeout", func(t *testing.T) {
+		loader := bark.NewLoader(dogs, &bark.LoaderOptions{Timeout: 5 * time.Millisecond})
+		slow := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "Find", Delay: 50 * time.Millisecond}))
+		if _, err := loader.Load("1111", slow); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the batch to time out, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package bark
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// Sets the logger bark writes to, nil restores slog.Default()
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Returns the logger bark writes to
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
+
+// Settings for logging the commands sent to MongoDB
+// Failed commands are logged at error level whenever All or SlowThreshold is set
+type CommandLogging struct {
+	// Logs every command at debug level
+	All bool
+	// Logs commands that take at least this long at warn level, 0 to disable
+	SlowThreshold time.Duration
+	// Logs the values in filters instead of replacing them with "?"
+	ShowValues bool
+}
+
+var commandLogging atomic.Pointer[CommandLogging]
+
+// Sets how commands are logged, the zero value turns command logging off
+// Applies to connections made by Connect, including ones made before it is called
+func SetCommandLogging(settings CommandLogging) {
+	commandLogging.Store(&settings)
+}
+
+// The part of a started command needed to log it when it finishes
+type startedCommand struct {
+	collection string
+	filter     bson.Raw
+}
+
+// Returns a command monitor that logs commands according to the command logging settings
+func newCommandMonitor() *event.CommandMonitor {
+	var started sync.Map
+	active := func() *CommandLogging {
+		if settings := commandLogging.Load(); settings != nil && (settings.All || settings.SlowThreshold > 0) {
+			return settings
+		}
+		return nil
+	}
+	finish := func(ctx context.Context, e event.CommandFinishedEvent, reply bson.Raw, failure error) {
+		value, ok := started.LoadAndDelete(e.RequestID)
+		settings := active()
+		if !ok || settings == nil {
+			return
+		}
+		command := value.(startedCommand)
+		slow := settings.SlowThreshold > 0 && e.Duration >= settings.SlowThreshold
+		if !slow && !settings.All && failure == nil {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("db", e.DatabaseName),
+			slog.String("collection", command.collection),
+			slog.String("operation", e.CommandName),
+			slog.Duration("duration", e.Duration),
+		}
+		if command.filter != nil {
+			attrs = append(attrs, slog.String("filter", formatFilter(command.filter, settings.ShowValues)))
+		}
+		if n, ok := reply.Lookup("n").AsInt64OK(); ok {
+			attrs = append(attrs, slog.Int64("n", n))
+		}
+		if batch, ok := reply.Lookup("cursor", "firstBatch").ArrayOK(); ok {
+			values, _ := batch.Values()
+			attrs = append(attrs, slog.Int("returned", len(values)))
+		}
+		level, msg := slog.LevelDebug, "bark command"
+		if slow {
+			level, msg = slog.LevelWarn, "bark slow command"
+			attrs = append(attrs, slog.Bool("slow", true))
+		}
+		if failure != nil {
+			level = slog.LevelError
+			attrs = append(attrs, slog.String("error", failure.Error()))
+		}
+		Logger().LogAttrs(ctx, level, msg, attrs...)
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if active() == nil {
+				return
+			}
+			collection, _ := e.Command.Lookup(e.CommandName).StringValueOK()
+			started.Store(e.RequestID, startedCommand{collection: collection, filter: commandFilter(e.Command)})
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(ctx, e.CommandFinishedEvent, e.Reply, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(ctx, e.CommandFinishedEvent, nil, e.Failure)
+		},
+	}
+}
+
+// Returns the filter of a command, copied because the driver reuses the command's buffer
+func commandFilter(command bson.Raw) bson.Raw {
+	for _, key := range []string{"filter", "query", "q"} {
+		if doc, ok := command.Lookup(key).DocumentOK(); ok {
+			return append(bson.Raw(nil), doc...)
+		}
+	}
+	for _, key := range []string{"updates", "deletes"} {
+		if statements, ok := command.Lookup(key).ArrayOK(); ok {
+			if doc, ok := firstDocument(statements).Lookup("q").DocumentOK(); ok {
+				return append(bson.Raw(nil), doc...)
+			}
+		}
+	}
+	if pipeline, ok := command.Lookup("pipeline").ArrayOK(); ok {
+		if match, ok := firstDocument(pipeline).Lookup("$match").DocumentOK(); ok {
+			return append(bson.Raw(nil), match...)
+		}
+	}
+	return nil
+}
+
+// Returns the first element of the array if it is a document
+func firstDocument(array bson.RawArray) bson.Raw {
+	value, err := array.IndexErr(0)
+	if err != nil {
+		return nil
+	}
+	doc, _ := value.DocumentOK()
+	return doc
+}
+
+// Formats a filter as extended JSON, replacing its values with "?" unless showValues is set
+func formatFilter(filter bson.Raw, showValues bool) string {
+	if showValues {
+		return filter.String()
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(filter, &doc); err != nil {
+		return "?"
+	}
+	data, err := bson.MarshalExtJSON(redact(doc), false, false)
+	if err != nil {
+		return "?"
+	}
+	return string(data)
+}
+
+// Replaces the values in a document with "?", keeping the field names and operators
+func redact(value any) any {
+	switch value := value.(type) {
+	case bson.D:
+		out := make(bson.D, len(value))
+		for i, e := range value {
+			out[i] = bson.E{Key: e.Key, Value: redact(e.Value)}
+		}
+		return out
+	case bson.A:
+		out := make(bson.A, len(value))
+		for i, v := range value {
+			out[i] = redact(v)
+		}
+		return out
+	default:
+		return "?"
+	}
+}
+
+// Returns the uri without its user name and password
+func redactUri(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "?"
+	}
+	u.User = nil
+	return u.String()
+}
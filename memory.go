@@ -0,0 +1,625 @@
+package bark
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const MemoryDbKey Key = "memoryDb"
+
+// An in-memory database that Collections and Models can use instead of MongoDB
+// It supports the filters, updates, upserts, sorting, paging, counting, simple aggregations and schema validation that bark uses,
+// so tests can run without a database server
+type MemoryDb struct {
+	mu          sync.Mutex
+	collections map[string]*memoryCollection
+	// Held by a transaction while it runs, operations outside the transaction wait for it
+	tx sync.RWMutex
+	// Tells databases apart in cache keys, since several may share a database name
+	id uint64
+}
+
+var memoryDbIds atomic.Uint64
+
+// Creates a new empty in-memory database
+func NewMemoryDb() *MemoryDb {
+	return &MemoryDb{collections: make(map[string]*memoryCollection), id: memoryDbIds.Add(1)}
+}
+
+var memoryDbsMu sync.RWMutex
+var memoryDbs = make(map[string]*MemoryDb)
+
+// Returns a context whose Collections and Models use the given in-memory database
+func WithMemoryDb(ctx context.Context, db *MemoryDb) context.Context {
+	return context.WithValue(ctx, MemoryDbKey, db)
+}
+
+// Makes every context with the given database name use the in-memory database
+// Pass nil to go back to MongoDB
+func UseMemoryDb(dbName string, db *MemoryDb) {
+	memoryDbsMu.Lock()
+	defer memoryDbsMu.Unlock()
+	if db == nil {
+		delete(memoryDbs, dbName)
+		return
+	}
+	memoryDbs[dbName] = db
+}
+
+// Returns the in-memory database selected by the context, or nil to use MongoDB
+func memoryDbFrom(ctx context.Context) *MemoryDb {
+	if db, ok := ctx.Value(MemoryDbKey).(*MemoryDb); ok {
+		return db
+	}
+	dbName, ok := ctx.Value(DbNameKey).(string)
+	if !ok {
+		return nil
+	}
+	memoryDbsMu.RLock()
+	defer memoryDbsMu.RUnlock()
+	return memoryDbs[dbName]
+}
+
+// Returns the backend for the named collection, creating the collection if needed
+func (db *MemoryDb) Collection(name string) Backend {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	collection, ok := db.collections[name]
+	if !ok {
+		collection = &memoryCollection{db: db, name: name}
+		db.collections[name] = collection
+	}
+	return collection
+}
+
+// Removes every collection from the database
+func (db *MemoryDb) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.collections = make(map[string]*memoryCollection)
+}
+
+// Copies the documents of every collection so they can be restored later
+func (db *MemoryDb) snapshot() map[string][]bson.D {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	snapshot := make(map[string][]bson.D, len(db.collections))
+	for name, collection := range db.collections {
+		collection.mu.Lock()
+		docs := make([]bson.D, len(collection.docs))
+		for i, doc := range collection.docs {
+			docs[i] = copyDocument(doc)
+		}
+		collection.mu.Unlock()
+		snapshot[name] = docs
+	}
+	return snapshot
+}
+
+// Puts every collection back the way it was when the snapshot was taken
+func (db *MemoryDb) restore(snapshot map[string][]bson.D) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for name, collection := range db.collections {
+		collection.mu.Lock()
+		collection.docs = snapshot[name]
+		collection.mu.Unlock()
+	}
+}
+
+// Waits for any transaction the context isn't part of to finish and keeps others from starting
+// Returns the function to call once the operation is done
+func (db *MemoryDb) enter(ctx context.Context) func() {
+	if ctx.Value(memoryTransactionKey) == db {
+		return func() {}
+	}
+	db.tx.RLock()
+	return db.tx.RUnlock
+}
+
+// Locks the collection once any transaction the context isn't part of has finished
+// Returns the function that unlocks it
+func (c *memoryCollection) lock(ctx context.Context) func() {
+	exit := c.db.enter(ctx)
+	c.mu.Lock()
+	return func() {
+		c.mu.Unlock()
+		exit()
+	}
+}
+
+// A collection of documents kept in insertion order
+type memoryCollection struct {
+	mu      sync.Mutex
+	db      *MemoryDb
+	name    string
+	docs    []bson.D
+	indexes map[string]bson.D
+	// The options the collection was created with, nil if it was created by using it
+	options *options.CreateCollectionOptions
+	// Closed when a document is inserted, to wake tailable cursors
+	inserted chan struct{}
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter any, opts *options.FindOptionsBuilder) (Cursor, error) {
+	findOpts, err := resolveOptions[options.FindOptions](opts)
+	if err != nil {
+		return nil, err
+	}
+	if findOpts.CursorType != nil && *findOpts.CursorType != options.NonTailable {
+		return c.tail(filter, findOpts)
+	}
+	defer c.lock(ctx)()
+	docs, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	if findOpts.Sort != nil {
+		if err := sortDocuments(docs, findOpts.Sort); err != nil {
+			return nil, err
+		}
+	} else if err := sortByNear(docs, filter); err != nil {
+		return nil, err
+	}
+	var skip, limit int64
+	if findOpts.Skip != nil {
+		skip = *findOpts.Skip
+	}
+	if findOpts.Limit != nil {
+		limit = *findOpts.Limit
+		if limit < 0 {
+			limit = -limit
+		}
+	}
+	docs = page(docs, skip, limit)
+	return newDocumentsCursor(docs, findOpts.Projection)
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter any, opts *options.FindOneOptionsBuilder) (bson.Raw, error) {
+	findOpts, err := resolveOptions[options.FindOneOptions](opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.lock(ctx)()
+	docs, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	if findOpts.Sort != nil {
+		if err := sortDocuments(docs, findOpts.Sort); err != nil {
+			return nil, err
+		}
+	}
+	if findOpts.Skip != nil {
+		docs = page(docs, *findOpts.Skip, 0)
+	}
+	if len(docs) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	doc, err := project(docs[0], findOpts.Projection)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(doc)
+}
+
+func (c *memoryCollection) CountDocuments(ctx context.Context, filter any) (int64, error) {
+	defer c.lock(ctx)()
+	docs, err := c.matching(filter)
+	return int64(len(docs)), err
+}
+
+func (c *memoryCollection) Distinct(ctx context.Context, fieldName string, filter any) (bson.RawArray, error) {
+	defer c.lock(ctx)()
+	docs, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	values := bson.A{}
+	for _, doc := range docs {
+		for _, value := range expandArrays(resolvePath(doc, fieldName)) {
+			if _, isArray := value.(bson.A); !isArray && !containsValue(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool { return compareValues(values[i], values[j]) < 0 })
+	data, err := bson.Marshal(bson.D{{Key: "values", Value: values}})
+	if err != nil {
+		return nil, err
+	}
+	return bson.Raw(data).Lookup("values").Array(), nil
+}
+
+// Records the index and returns its name
+// Indexes don't change how the in-memory backend queries, they are kept so tests can check what was created
+func (c *memoryCollection) CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptionsBuilder) (string, error) {
+	indexOpts, err := resolveOptions[options.IndexOptions](opts)
+	if err != nil {
+		return "", err
+	}
+	name := indexName(keys)
+	if indexOpts.Name != nil {
+		name = *indexOpts.Name
+	}
+	defer c.lock(ctx)()
+	if c.indexes == nil {
+		c.indexes = make(map[string]bson.D)
+	}
+	c.indexes[name] = copyDocument(keys)
+	return name, nil
+}
+
+// Returns the name MongoDB gives an index with the keys, like Name_1_Age_-1
+func indexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Returns the keys of each index created on the collection by name
+func (db *MemoryDb) Indexes(collection string) map[string]bson.D {
+	c := db.Collection(collection).(*memoryCollection)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	indexes := make(map[string]bson.D, len(c.indexes))
+	for name, keys := range c.indexes {
+		indexes[name] = copyDocument(keys)
+	}
+	return indexes
+}
+
+// Records the options the collection was created with
+// Fails like MongoDB if the collection was already created or has documents
+func (c *memoryCollection) CreateCollection(ctx context.Context, opts *options.CreateCollectionOptionsBuilder) error {
+	createOpts, err := resolveOptions[options.CreateCollectionOptions](opts)
+	if err != nil {
+		return err
+	}
+	defer c.lock(ctx)()
+	if c.options != nil || len(c.docs) > 0 {
+		return mongo.CommandError{Code: namespaceExists, Name: "NamespaceExists", Message: "Collection already exists"}
+	}
+	c.options = createOpts
+	return nil
+}
+
+// Returns the options the named collection was created with, nil if it wasn't created explicitly
+func (db *MemoryDb) CollectionOptions(collection string) *options.CreateCollectionOptions {
+	c := db.Collection(collection).(*memoryCollection)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.options
+}
+
+func (c *memoryCollection) InsertOne(ctx context.Context, document any) (*mongo.InsertOneResult, error) {
+	defer c.lock(ctx)()
+	id, err := c.insert(document)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: id, Acknowledged: true}, nil
+}
+
+func (c *memoryCollection) InsertMany(ctx context.Context, documents []any) (*mongo.InsertManyResult, error) {
+	defer c.lock(ctx)()
+	result := &mongo.InsertManyResult{Acknowledged: true}
+	for _, document := range documents {
+		id, err := c.insert(document)
+		if err != nil {
+			return result, err
+		}
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+	return result, nil
+}
+
+func (c *memoryCollection) UpdateOne(ctx context.Context, filter any, update any, opts *options.UpdateOneOptionsBuilder) (*mongo.UpdateResult, error) {
+	updateOpts, err := resolveOptions[options.UpdateOneOptions](opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.lock(ctx)()
+	return c.update(filter, update, false, updateOpts.Upsert != nil && *updateOpts.Upsert, false)
+}
+
+func (c *memoryCollection) UpdateMany(ctx context.Context, filter any, update any, opts *options.UpdateManyOptionsBuilder) (*mongo.UpdateResult, error) {
+	updateOpts, err := resolveOptions[options.UpdateManyOptions](opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.lock(ctx)()
+	return c.update(filter, update, true, updateOpts.Upsert != nil && *updateOpts.Upsert, false)
+}
+
+func (c *memoryCollection) ReplaceOne(ctx context.Context, filter any, replacement any, opts *options.ReplaceOptionsBuilder) (*mongo.UpdateResult, error) {
+	replaceOpts, err := resolveOptions[options.ReplaceOptions](opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.lock(ctx)()
+	return c.update(filter, replacement, false, replaceOpts.Upsert != nil && *replaceOpts.Upsert, true)
+}
+
+func (c *memoryCollection) DeleteOne(ctx context.Context, filter any) (*mongo.DeleteResult, error) {
+	defer c.lock(ctx)()
+	return c.delete(filter, false)
+}
+
+func (c *memoryCollection) DeleteMany(ctx context.Context, filter any) (*mongo.DeleteResult, error) {
+	defer c.lock(ctx)()
+	return c.delete(filter, true)
+}
+
+// Returns copies of the documents matching the filter, the caller must hold the lock
+func (c *memoryCollection) matching(filter any) ([]bson.D, error) {
+	matches, err := c.indexesMatching(filter)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]bson.D, len(matches))
+	for i, index := range matches {
+		docs[i] = copyDocument(c.docs[index])
+	}
+	return docs, nil
+}
+
+// Returns the positions of the documents matching the filter, the caller must hold the lock
+func (c *memoryCollection) indexesMatching(filter any) ([]int, error) {
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	var matches []int
+	for i, doc := range c.docs {
+		ok, err := matchDocument(doc, query)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, i)
+		}
+	}
+	return matches, nil
+}
+
+// Adds a document, generating an _id if it doesn't have one, the caller must hold the lock
+func (c *memoryCollection) insert(document any) (any, error) {
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	id, ok := getPath(doc, "_id")
+	if !ok {
+		id = bson.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+	if c.hasId(id) {
+		return nil, duplicateKeyError(id)
+	}
+	if err := c.validate(nil, doc); err != nil {
+		return nil, err
+	}
+	c.docs = append(c.docs, doc)
+	c.applyCap()
+	if c.inserted != nil {
+		close(c.inserted)
+		c.inserted = nil
+	}
+	return id, nil
+}
+
+// Returns true if a document already uses the _id, the caller must hold the lock
+func (c *memoryCollection) hasId(id any) bool {
+	for _, doc := range c.docs {
+		if existing, ok := getPath(doc, "_id"); ok && equalValues(existing, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies an update or replacement to the first or all matching documents, the caller must hold the lock
+func (c *memoryCollection) update(filter any, update any, many bool, upsert bool, replace bool) (*mongo.UpdateResult, error) {
+	changes, err := toDocument(update)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update: %w", err)
+	}
+	if !replace && !isOperatorDocument(changes) {
+		return nil, fmt.Errorf("update document must contain only update operators")
+	}
+	if replace && isOperatorDocument(changes) {
+		return nil, fmt.Errorf("replacement document must not contain update operators")
+	}
+	matches, err := c.indexesMatching(filter)
+	if err != nil {
+		return nil, err
+	}
+	result := &mongo.UpdateResult{Acknowledged: true}
+	if len(matches) == 0 {
+		if !upsert {
+			return result, nil
+		}
+		doc, err := upsertDocument(filter, changes, replace)
+		if err != nil {
+			return nil, err
+		}
+		id, err := c.insert(doc)
+		if err != nil {
+			return nil, err
+		}
+		result.UpsertedCount = 1
+		result.UpsertedID = id
+		return result, nil
+	}
+	if !many {
+		matches = matches[:1]
+	}
+	for _, index := range matches {
+		before := c.docs[index]
+		var after bson.D
+		if replace {
+			after, err = replaceDocument(before, changes)
+		} else {
+			after, err = applyUpdate(copyDocument(before), changes, false)
+		}
+		if err == nil {
+			err = c.validate(before, after)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.MatchedCount++
+		if !sameDocument(before, after) {
+			result.ModifiedCount++
+			c.docs[index] = after
+		}
+	}
+	return result, nil
+}
+
+// Removes the first or all matching documents, the caller must hold the lock
+func (c *memoryCollection) delete(filter any, many bool) (*mongo.DeleteResult, error) {
+	matches, err := c.indexesMatching(filter)
+	if err != nil {
+		return nil, err
+	}
+	if !many && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	removed := make(map[int]bool, len(matches))
+	for _, index := range matches {
+		removed[index] = true
+	}
+	kept := c.docs[:0:0]
+	for i, doc := range c.docs {
+		if !removed[i] {
+			kept = append(kept, doc)
+		}
+	}
+	c.docs = kept
+	return &mongo.DeleteResult{DeletedCount: int64(len(matches)), Acknowledged: true}, nil
+}
+
+// Returns the error MongoDB gives when a unique key is reused
+func duplicateKeyError(id any) error {
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: fmt.Sprintf("E11000 duplicate key error dup key: { _id: %v }", id),
+	}}}
+}
+
+// Returns the documents after skipping and limiting, a limit of 0 means no limit
+func page(docs []bson.D, skip int64, limit int64) []bson.D {
+	if skip >= int64(len(docs)) {
+		return nil
+	}
+	docs = docs[skip:]
+	if limit > 0 && limit < int64(len(docs)) {
+		docs = docs[:limit]
+	}
+	return docs
+}
+
+// Converts any value that marshals to a BSON document into a bson.D, nil gives an empty document
+func toDocument(value any) (bson.D, error) {
+	if value == nil {
+		return bson.D{}, nil
+	}
+	if raw, ok := value.(bson.Raw); ok {
+		var doc bson.D
+		err := bson.Unmarshal(raw, &doc)
+		return doc, err
+	}
+	bsonBytes, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(bsonBytes, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Returns a deep copy of the document
+func copyDocument(doc bson.D) bson.D {
+	return copyValue(doc).(bson.D)
+}
+
+// Returns a deep copy of documents and arrays, other values are immutable
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case bson.D:
+		doc := make(bson.D, len(v))
+		for i, elem := range v {
+			doc[i] = bson.E{Key: elem.Key, Value: copyValue(elem.Value)}
+		}
+		return doc
+	case bson.A:
+		array := make(bson.A, len(v))
+		for i, elem := range v {
+			array[i] = copyValue(elem)
+		}
+		return array
+	}
+	return value
+}
+
+// Returns true if both documents have the same encoding
+func sameDocument(a bson.D, b bson.D) bool {
+	aBytes, aErr := bson.Marshal(a)
+	bBytes, bErr := bson.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aBytes, bBytes)
+}
+
+// A cursor over documents that have already been loaded
+type documentsCursor struct {
+	docs    []bson.Raw
+	current bson.Raw
+	err     error
+}
+
+// Projects and encodes the documents into a cursor
+func newDocumentsCursor(docs []bson.D, projection any) (Cursor, error) {
+	cursor := &documentsCursor{}
+	for _, doc := range docs {
+		projected, err := project(doc, projection)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := bson.Marshal(projected)
+		if err != nil {
+			return nil, err
+		}
+		cursor.docs = append(cursor.docs, raw)
+	}
+	return cursor, nil
+}
+
+func (c *documentsCursor) Next(ctx context.Context) bool {
+	if c.err != nil || len(c.docs) == 0 {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	c.current, c.docs = c.docs[0], c.docs[1:]
+	return true
+}
+
+func (c *documentsCursor) Current() bson.Raw               { return c.current }
+func (c *documentsCursor) Err() error                      { return c.err }
+func (c *documentsCursor) Close(ctx context.Context) error { c.docs = nil; return nil }
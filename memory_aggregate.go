@@ -0,0 +1,409 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Runs the pipeline over the collection
+// Supports the $match, $sort, $skip, $limit, $project, $unwind, $count, $group, $facet, $geoNear, $setWindowFields and $lookup stages
+func (c *memoryCollection) Aggregate(ctx context.Context, pipeline any) (Cursor, error) {
+	stages, err := toPipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer c.db.enter(ctx)()
+	c.mu.Lock()
+	docs, err := c.matching(bson.D{})
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	// The lock is released first so $lookup can read this collection too
+	for _, stage := range stages {
+		if docs, err = c.runStage(docs, stage); err != nil {
+			return nil, err
+		}
+	}
+	return newDocumentsCursor(docs, nil)
+}
+
+// Converts a pipeline given as mongo.Pipeline, bson.A or a slice of documents into its stages
+func toPipeline(pipeline any) ([]bson.D, error) {
+	data, err := bson.Marshal(bson.D{{Key: "pipeline", Value: pipeline}})
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %w", err)
+	}
+	var wrapper struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	if err := bson.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %w", err)
+	}
+	return wrapper.Pipeline, nil
+}
+
+// Applies a single pipeline stage to the documents
+func (c *memoryCollection) runStage(docs []bson.D, stage bson.D) ([]bson.D, error) {
+	if len(stage) != 1 {
+		return nil, fmt.Errorf("a pipeline stage must have exactly one field, got %d", len(stage))
+	}
+	name, arg := stage[0].Key, stage[0].Value
+	switch name {
+	case "$match":
+		query, err := toDocument(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $match: %w", err)
+		}
+		var matched []bson.D
+		for _, doc := range docs {
+			ok, err := matchDocument(doc, query)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, doc)
+			}
+		}
+		return matched, nil
+	case "$sort":
+		return docs, sortDocuments(docs, arg)
+	case "$skip":
+		n, ok := toFloat(arg)
+		if !ok {
+			return nil, fmt.Errorf("$skip needs a number, got %T", arg)
+		}
+		return page(docs, int64(n), 0), nil
+	case "$limit":
+		n, ok := toFloat(arg)
+		if !ok {
+			return nil, fmt.Errorf("$limit needs a number, got %T", arg)
+		}
+		return page(docs, 0, int64(n)), nil
+	case "$project":
+		projected := make([]bson.D, len(docs))
+		for i, doc := range docs {
+			var err error
+			if projected[i], err = project(doc, arg); err != nil {
+				return nil, err
+			}
+		}
+		return projected, nil
+	case "$unwind":
+		return unwind(docs, arg)
+	case "$count":
+		field, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("$count needs a field name, got %T", arg)
+		}
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	case "$lookup":
+		return c.lookup(docs, arg)
+	case "$group":
+		return group(docs, arg)
+	case "$facet":
+		return c.facet(docs, arg)
+	case "$geoNear":
+		return geoNear(docs, arg)
+	case "$setWindowFields":
+		return setWindowFields(docs, arg)
+	}
+	return nil, fmt.Errorf("%w: pipeline stage %s", ErrNotSupportedInMemory, name)
+}
+
+// Adds the documents of another collection whose foreignField equals the localField, as $lookup does
+// Only the localField and foreignField form is supported
+func (c *memoryCollection) lookup(docs []bson.D, arg any) ([]bson.D, error) {
+	spec, err := toDocument(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $lookup: %w", err)
+	}
+	from, _ := lookupKey(spec, "from")
+	localField, _ := lookupKey(spec, "localField")
+	foreignField, _ := lookupKey(spec, "foreignField")
+	as, _ := lookupKey(spec, "as")
+	fromName, ok1 := from.(string)
+	local, ok2 := localField.(string)
+	foreign, ok3 := foreignField.(string)
+	asName, ok4 := as.(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, fmt.Errorf("%w: $lookup without from, localField, foreignField and as", ErrNotSupportedInMemory)
+	}
+	other := c.db.Collection(fromName).(*memoryCollection)
+	other.mu.Lock()
+	foreignDocs, err := other.matching(bson.D{})
+	other.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		values := expandArrays(resolvePath(doc, local))
+		if len(values) == 0 {
+			values = []any{nil}
+		}
+		joined := bson.A{}
+		for _, foreignDoc := range foreignDocs {
+			for _, value := range values {
+				if matchEquality(resolvePath(foreignDoc, foreign), value) {
+					joined = append(joined, copyDocument(foreignDoc))
+					break
+				}
+			}
+		}
+		if docs[i], err = setPath(doc, asName, joined); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// Outputs a document for each element of an array field, as $unwind does
+func unwind(docs []bson.D, arg any) ([]bson.D, error) {
+	path, preserve := "", false
+	switch arg := arg.(type) {
+	case string:
+		path = arg
+	case bson.D:
+		value, _ := lookupKey(arg, "path")
+		path, _ = value.(string)
+		value, _ = lookupKey(arg, "preserveNullAndEmptyArrays")
+		preserve = truthy(value)
+	}
+	if len(path) < 2 || path[0] != '$' {
+		return nil, fmt.Errorf("$unwind needs a field path starting with $, got %v", arg)
+	}
+	path = path[1:]
+	var unwound []bson.D
+	for _, doc := range docs {
+		value, ok := getPath(doc, path)
+		array, isArray := value.(bson.A)
+		switch {
+		case isArray && len(array) > 0:
+			for _, item := range array {
+				next, err := setPath(copyDocument(doc), path, copyValue(item))
+				if err != nil {
+					return nil, err
+				}
+				unwound = append(unwound, next)
+			}
+		case ok && !isArray && value != nil:
+			unwound = append(unwound, doc)
+		case preserve:
+			if isArray {
+				doc = unsetPath(doc, path)
+			}
+			unwound = append(unwound, doc)
+		}
+	}
+	return unwound, nil
+}
+
+// Runs each sub-pipeline over the documents and outputs one document with the results, as $facet does
+func (c *memoryCollection) facet(docs []bson.D, arg any) ([]bson.D, error) {
+	spec, err := toDocument(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $facet: %w", err)
+	}
+	output := bson.D{}
+	for _, elem := range spec {
+		stages, err := toPipeline(elem.Value)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]bson.D, len(docs))
+		for i, doc := range docs {
+			results[i] = copyDocument(doc)
+		}
+		for _, stage := range stages {
+			if results, err = c.runStage(results, stage); err != nil {
+				return nil, err
+			}
+		}
+		array := make(bson.A, len(results))
+		for i, result := range results {
+			array[i] = result
+		}
+		output = append(output, bson.E{Key: elem.Key, Value: array})
+	}
+	return []bson.D{output}, nil
+}
+
+// Groups the documents by the _id expression and accumulates the other fields, as $group does
+// Supports the $sum, $avg, $min, $max, $first, $last, $push, $addToSet and $count accumulators
+func group(docs []bson.D, arg any) ([]bson.D, error) {
+	spec, err := toDocument(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $group: %w", err)
+	}
+	idExpr, ok := lookupKey(spec, "_id")
+	if !ok {
+		return nil, fmt.Errorf("$group needs an _id")
+	}
+	type groupState struct {
+		id           any
+		accumulators []*accumulator
+	}
+	var groups []*groupState
+	for _, doc := range docs {
+		id, err := evaluate(doc, idExpr)
+		if err != nil {
+			return nil, err
+		}
+		var state *groupState
+		for _, existing := range groups {
+			if equalValues(existing.id, id) {
+				state = existing
+				break
+			}
+		}
+		if state == nil {
+			state = &groupState{id: id}
+			for _, elem := range spec {
+				if elem.Key == "_id" {
+					continue
+				}
+				acc, err := newAccumulator(elem)
+				if err != nil {
+					return nil, err
+				}
+				state.accumulators = append(state.accumulators, acc)
+			}
+			groups = append(groups, state)
+		}
+		for _, acc := range state.accumulators {
+			if err := acc.add(doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	output := make([]bson.D, len(groups))
+	for i, state := range groups {
+		doc := bson.D{{Key: "_id", Value: state.id}}
+		for _, acc := range state.accumulators {
+			doc = append(doc, bson.E{Key: acc.field, Value: acc.result()})
+		}
+		output[i] = doc
+	}
+	return output, nil
+}
+
+// Returns the value of an expression for the document
+// Supports field paths like "$Name", documents of expressions, $dateTrunc and constants
+func evaluate(doc bson.D, expr any) (any, error) {
+	switch expr := expr.(type) {
+	case string:
+		if strings.HasPrefix(expr, "$") {
+			value, _ := getPath(doc, expr[1:])
+			return copyValue(value), nil
+		}
+	case bson.D:
+		if isOperatorDocument(expr) {
+			if len(expr) == 1 && expr[0].Key == "$dateTrunc" {
+				return dateTrunc(doc, expr[0].Value)
+			}
+			return nil, fmt.Errorf("%w: expression operator %s", ErrNotSupportedInMemory, expr[0].Key)
+		}
+		evaluated := bson.D{}
+		for _, elem := range expr {
+			value, err := evaluate(doc, elem.Value)
+			if err != nil {
+				return nil, err
+			}
+			evaluated = append(evaluated, bson.E{Key: elem.Key, Value: value})
+		}
+		return evaluated, nil
+	}
+	return expr, nil
+}
+
+// Accumulates one output field of a $group
+type accumulator struct {
+	field    string
+	operator string
+	expr     any
+	value    any
+	sum      float64
+	count    int
+	started  bool
+}
+
+// Creates the accumulator for a field like {total: {$sum: "$Amount"}}
+func newAccumulator(elem bson.E) (*accumulator, error) {
+	spec, ok := elem.Value.(bson.D)
+	if !ok || len(spec) != 1 {
+		return nil, fmt.Errorf("$group field %s needs a single accumulator", elem.Key)
+	}
+	acc := &accumulator{field: elem.Key, operator: spec[0].Key, expr: spec[0].Value}
+	switch acc.operator {
+	case "$sum":
+		acc.value = int32(0)
+	case "$count":
+		acc.operator, acc.expr, acc.value = "$sum", int32(1), int32(0)
+	case "$push", "$addToSet":
+		acc.value = bson.A{}
+	case "$avg", "$min", "$max", "$first", "$last":
+	default:
+		return nil, fmt.Errorf("%w: accumulator %s", ErrNotSupportedInMemory, acc.operator)
+	}
+	return acc, nil
+}
+
+// Adds the document to the accumulator
+func (acc *accumulator) add(doc bson.D) error {
+	value, err := evaluate(doc, acc.expr)
+	if err != nil {
+		return err
+	}
+	switch acc.operator {
+	case "$sum":
+		if _, ok := toFloat(value); ok {
+			if acc.value, err = addNumbers(acc.value, value); err != nil {
+				return err
+			}
+		}
+	case "$avg":
+		if number, ok := toFloat(value); ok {
+			acc.sum += number
+			acc.count++
+		}
+	case "$min", "$max":
+		if value == nil {
+			return nil
+		}
+		comparison := compareValues(value, acc.value)
+		if !acc.started || (acc.operator == "$min" && comparison < 0) || (acc.operator == "$max" && comparison > 0) {
+			acc.value = value
+		}
+		acc.started = true
+	case "$first":
+		if !acc.started {
+			acc.value, acc.started = value, true
+		}
+	case "$last":
+		acc.value = value
+	case "$push":
+		acc.value = append(acc.value.(bson.A), value)
+	case "$addToSet":
+		if !containsValue(acc.value.(bson.A), value) {
+			acc.value = append(acc.value.(bson.A), value)
+		}
+	}
+	return nil
+}
+
+// Returns the accumulated value
+func (acc *accumulator) result() any {
+	if acc.operator == "$avg" {
+		if acc.count == 0 {
+			return nil
+		}
+		return acc.sum / float64(acc.count)
+	}
+	return acc.value
+}
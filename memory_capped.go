@@ -0,0 +1,140 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Removes the oldest documents while a capped collection is over its limits, the caller must hold the lock
+// The size of a document is the length of its BSON encoding
+func (c *memoryCollection) applyCap() {
+	if c.options == nil || c.options.Capped == nil || !*c.options.Capped {
+		return
+	}
+	var size int64
+	for _, doc := range c.docs {
+		data, _ := bson.Marshal(doc)
+		size += int64(len(data))
+	}
+	for len(c.docs) > 1 {
+		overSize := c.options.SizeInBytes != nil && size > *c.options.SizeInBytes
+		overMax := c.options.MaxDocuments != nil && *c.options.MaxDocuments > 0 && int64(len(c.docs)) > *c.options.MaxDocuments
+		if !overSize && !overMax {
+			return
+		}
+		data, _ := bson.Marshal(c.docs[0])
+		size -= int64(len(data))
+		c.docs = c.docs[1:]
+	}
+}
+
+// Opens a tailable cursor over the documents matching the filter in insertion order
+// As with MongoDB the collection must be capped and the cursor is closed straight away if the collection is empty
+func (c *memoryCollection) tail(filter any, findOpts *options.FindOptions) (Cursor, error) {
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.options == nil || c.options.Capped == nil || !*c.options.Capped {
+		return nil, fmt.Errorf("tailable cursor requested on a collection that isn't capped")
+	}
+	if findOpts.Sort != nil {
+		return nil, fmt.Errorf("%w: sorting a tailable cursor", ErrNotSupportedInMemory)
+	}
+	if len(c.docs) == 0 {
+		return newDocumentsCursor(nil, nil)
+	}
+	// Like the server, the cursor is positioned when it is opened rather than on the first call to Next
+	first, _ := getPath(c.docs[0], "_id")
+	return &tailingCursor{collection: c, query: query, projection: findOpts.Projection, first: first}, nil
+}
+
+// A cursor that waits for documents to be inserted once it has returned the existing ones
+type tailingCursor struct {
+	collection *memoryCollection
+	query      bson.D
+	projection any
+	// The _id of the oldest document when the cursor was opened, where the scan starts
+	first any
+	// The _id of the last document scanned, nil before the first
+	last    any
+	current bson.Raw
+	err     error
+	closed  bool
+}
+
+func (c *tailingCursor) Next(ctx context.Context) bool {
+	for c.err == nil && !c.closed {
+		wait, found := c.scan()
+		if found {
+			return true
+		}
+		if wait == nil {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			c.err = ctx.Err()
+		case <-wait:
+		}
+	}
+	return false
+}
+
+// Moves to the next matching document after the last one scanned
+// Returns a channel that is closed on the next insert if there isn't one yet
+func (c *tailingCursor) scan() (<-chan struct{}, bool) {
+	collection := c.collection
+	collection.mu.Lock()
+	defer collection.mu.Unlock()
+	// The scan resumes after the last document scanned, or starts at the first
+	position, offset := c.last, 1
+	if position == nil {
+		position, offset = c.first, 0
+	}
+	start := -1
+	for i, doc := range collection.docs {
+		if id, ok := getPath(doc, "_id"); ok && equalValues(id, position) {
+			start = i + offset
+			break
+		}
+	}
+	if start < 0 {
+		c.err = mongo.CommandError{Code: cappedPositionLost, Name: "CappedPositionLost", Message: "the tailable cursor's position was overwritten"}
+		return nil, false
+	}
+	for _, doc := range collection.docs[start:] {
+		c.last, _ = getPath(doc, "_id")
+		ok, err := matchDocument(doc, c.query)
+		if err != nil {
+			c.err = err
+			return nil, false
+		}
+		if !ok {
+			continue
+		}
+		projected, err := project(copyDocument(doc), c.projection)
+		if err == nil {
+			c.current, err = bson.Marshal(projected)
+		}
+		if err != nil {
+			c.err = err
+			return nil, false
+		}
+		return nil, true
+	}
+	if collection.inserted == nil {
+		collection.inserted = make(chan struct{})
+	}
+	return collection.inserted, false
+}
+
+func (c *tailingCursor) Current() bson.Raw               { return c.current }
+func (c *tailingCursor) Err() error                      { return c.err }
+func (c *tailingCursor) Close(ctx context.Context) error { c.closed = true; return nil }
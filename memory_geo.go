@@ -0,0 +1,271 @@
+package bark
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// The earth radius MongoDB uses for spherical distances, in meters
+const earthRadius = 6378100.0
+
+// Returns the coordinates of a GeoJSON point or a legacy [lng, lat] pair
+func pointOf(value any) (lng float64, lat float64, ok bool) {
+	if doc, isDoc := value.(bson.D); isDoc {
+		if kind, _ := lookupKey(doc, "type"); kind != "Point" {
+			return 0, 0, false
+		}
+		value, _ = lookupKey(doc, "coordinates")
+	}
+	pair, isArray := value.(bson.A)
+	if !isArray || len(pair) != 2 {
+		return 0, 0, false
+	}
+	lng, okLng := toFloat(pair[0])
+	lat, okLat := toFloat(pair[1])
+	return lng, lat, okLng && okLat
+}
+
+// Returns the distance in meters between two points on the earth
+func distance(lng1, lat1, lng2, lat2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLng := (lng2 - lng1) * toRadians
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// The point and distance limits of a $near condition
+type nearCondition struct {
+	lng, lat float64
+	min, max float64
+	hasMax   bool
+}
+
+// Parses {$geometry: point, $minDistance: m, $maxDistance: m}
+func parseNear(arg any) (nearCondition, error) {
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return nearCondition{}, fmt.Errorf("%w: $near without $geometry", ErrNotSupportedInMemory)
+	}
+	geometry, _ := lookupKey(spec, "$geometry")
+	var near nearCondition
+	if near.lng, near.lat, ok = pointOf(geometry); !ok {
+		return nearCondition{}, fmt.Errorf("%w: $near needs a GeoJSON point", ErrNotSupportedInMemory)
+	}
+	if value, ok := lookupKey(spec, "$minDistance"); ok {
+		near.min, _ = toFloat(value)
+	}
+	if value, ok := lookupKey(spec, "$maxDistance"); ok {
+		near.max, near.hasMax = toFloat(value)
+	}
+	return near, nil
+}
+
+// Returns the distance to the nearest point among the values, and false if none is a point
+func (near nearCondition) nearest(values []any) (float64, bool) {
+	best, found := math.Inf(1), false
+	for _, value := range values {
+		if lng, lat, ok := pointOf(value); ok {
+			best, found = math.Min(best, distance(near.lng, near.lat, lng, lat)), true
+		}
+	}
+	return best, found
+}
+
+// Returns true if the nearest point among the values is within the distance limits
+func (near nearCondition) matches(values []any) bool {
+	d, ok := near.nearest(values)
+	return ok && d >= near.min && (!near.hasMax || d <= near.max)
+}
+
+// Returns true if any of the points among the values is inside the $geoWithin shape
+// Supports $geometry polygons and $centerSphere
+func matchGeoWithin(values []any, arg any) (bool, error) {
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return false, fmt.Errorf("$geoWithin needs a document")
+	}
+	if geometry, ok := lookupKey(spec, "$geometry"); ok {
+		rings, err := polygonRings(geometry)
+		if err != nil {
+			return false, err
+		}
+		for _, value := range values {
+			if lng, lat, ok := pointOf(value); ok && insidePolygon(lng, lat, rings) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if sphere, ok := lookupKey(spec, "$centerSphere"); ok {
+		args, ok := sphere.(bson.A)
+		if !ok || len(args) != 2 {
+			return false, fmt.Errorf("$centerSphere needs a center and a radius")
+		}
+		lng, lat, okCenter := pointOf(args[0])
+		radius, okRadius := toFloat(args[1])
+		if !okCenter || !okRadius {
+			return false, fmt.Errorf("$centerSphere needs a center and a radius")
+		}
+		near := nearCondition{lng: lng, lat: lat, max: radius * earthRadius, hasMax: true}
+		return near.matches(values), nil
+	}
+	return false, fmt.Errorf("%w: $geoWithin shape %v", ErrNotSupportedInMemory, spec)
+}
+
+// Returns the rings of a GeoJSON polygon as lng, lat pairs
+func polygonRings(geometry any) ([][][2]float64, error) {
+	doc, ok := geometry.(bson.D)
+	if kind, _ := lookupKey(doc, "type"); !ok || kind != "Polygon" {
+		return nil, fmt.Errorf("%w: $geometry other than a Polygon", ErrNotSupportedInMemory)
+	}
+	coordinates, _ := lookupKey(doc, "coordinates")
+	ringsArray, ok := coordinates.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("polygon coordinates must be an array of rings")
+	}
+	rings := make([][][2]float64, len(ringsArray))
+	for i, ring := range ringsArray {
+		points, ok := ring.(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("polygon ring must be an array of points")
+		}
+		for _, point := range points {
+			lng, lat, ok := pointOf(point)
+			if !ok {
+				return nil, fmt.Errorf("polygon point must be a [lng, lat] pair")
+			}
+			rings[i] = append(rings[i], [2]float64{lng, lat})
+		}
+	}
+	return rings, nil
+}
+
+// Returns true if the point is inside the outline and outside the holes, treating coordinates as planar
+func insidePolygon(lng, lat float64, rings [][][2]float64) bool {
+	if len(rings) == 0 || !insideRing(lng, lat, rings[0]) {
+		return false
+	}
+	for _, hole := range rings[1:] {
+		if insideRing(lng, lat, hole) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ray casting test for a point inside a ring
+func insideRing(lng, lat float64, ring [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > lat) != (b[1] > lat) && lng < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Sorts the documents nearest first if the filter has a top level $near condition, as MongoDB does
+func sortByNear(docs []bson.D, filter any) error {
+	query, err := toDocument(filter)
+	if err != nil {
+		return err
+	}
+	for _, elem := range query {
+		condition, ok := elem.Value.(bson.D)
+		if !ok {
+			continue
+		}
+		arg, ok := lookupKey(condition, "$near")
+		if !ok {
+			arg, ok = lookupKey(condition, "$nearSphere")
+		}
+		if !ok {
+			continue
+		}
+		near, err := parseNear(arg)
+		if err != nil {
+			return err
+		}
+		distances := make([]float64, len(docs))
+		for i, doc := range docs {
+			distances[i], _ = near.nearest(resolvePath(doc, elem.Key))
+		}
+		sort.Stable(byDistance{docs, distances})
+		return nil
+	}
+	return nil
+}
+
+// Sorts documents by their distances
+type byDistance struct {
+	docs      []bson.D
+	distances []float64
+}
+
+func (s byDistance) Len() int           { return len(s.docs) }
+func (s byDistance) Less(i, j int) bool { return s.distances[i] < s.distances[j] }
+func (s byDistance) Swap(i, j int) {
+	s.docs[i], s.docs[j] = s.docs[j], s.docs[i]
+	s.distances[i], s.distances[j] = s.distances[j], s.distances[i]
+}
+
+// Outputs the documents with a point at key within the distance limits, nearest first, as $geoNear does
+func geoNear(docs []bson.D, arg any) ([]bson.D, error) {
+	spec, err := toDocument(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $geoNear: %w", err)
+	}
+	nearValue, _ := lookupKey(spec, "near")
+	distanceField, _ := lookupKey(spec, "distanceField")
+	keyValue, _ := lookupKey(spec, "key")
+	field, okField := distanceField.(string)
+	key, okKey := keyValue.(string)
+	if !okField || !okKey {
+		return nil, fmt.Errorf("%w: $geoNear without distanceField and key", ErrNotSupportedInMemory)
+	}
+	var near nearCondition
+	var ok bool
+	if near.lng, near.lat, ok = pointOf(nearValue); !ok {
+		return nil, fmt.Errorf("$geoNear needs a near point")
+	}
+	if value, ok := lookupKey(spec, "minDistance"); ok {
+		near.min, _ = toFloat(value)
+	}
+	if value, ok := lookupKey(spec, "maxDistance"); ok {
+		near.max, near.hasMax = toFloat(value)
+	}
+	query := bson.D{}
+	if value, ok := lookupKey(spec, "query"); ok {
+		if query, err = toDocument(value); err != nil {
+			return nil, fmt.Errorf("invalid $geoNear query: %w", err)
+		}
+	}
+	var matched []bson.D
+	var distances []float64
+	for _, doc := range docs {
+		values := resolvePath(doc, key)
+		if !near.matches(values) {
+			continue
+		}
+		if ok, err := matchDocument(doc, query); err != nil || !ok {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		d, _ := near.nearest(values)
+		if doc, err = setPath(doc, field, d); err != nil {
+			return nil, err
+		}
+		matched = append(matched, doc)
+		distances = append(distances, d)
+	}
+	sort.Stable(byDistance{matched, distances})
+	return matched, nil
+}
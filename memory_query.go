@@ -0,0 +1,606 @@
+package bark
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Returns true if the document matches the query
+func matchDocument(doc bson.D, query bson.D) (bool, error) {
+	for _, elem := range query {
+		ok, err := matchElement(doc, elem)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Returns true if the document matches a single top level query element
+func matchElement(doc bson.D, elem bson.E) (bool, error) {
+	switch elem.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := elem.Value.(bson.A)
+		if !ok || len(clauses) == 0 {
+			return false, fmt.Errorf("%s must be a nonempty array", elem.Key)
+		}
+		for _, clause := range clauses {
+			query, ok := clause.(bson.D)
+			if !ok {
+				return false, fmt.Errorf("%s entries must be documents", elem.Key)
+			}
+			ok, err := matchDocument(doc, query)
+			if err != nil {
+				return false, err
+			}
+			if elem.Key == "$and" && !ok {
+				return false, nil
+			}
+			if elem.Key == "$or" && ok {
+				return true, nil
+			}
+			if elem.Key == "$nor" && ok {
+				return false, nil
+			}
+		}
+		return elem.Key != "$or", nil
+	case "$comment":
+		return true, nil
+	case "$jsonSchema":
+		schema, err := toDocument(elem.Value)
+		if err != nil {
+			return false, fmt.Errorf("invalid $jsonSchema: %w", err)
+		}
+		return matchSchema(doc, schema)
+	}
+	if strings.HasPrefix(elem.Key, "$") {
+		return false, fmt.Errorf("%w: query operator %s", ErrNotSupportedInMemory, elem.Key)
+	}
+	values := resolvePath(doc, elem.Key)
+	if condition, ok := elem.Value.(bson.D); ok && isOperatorDocument(condition) {
+		return matchOperators(values, condition)
+	}
+	return matchEquality(values, elem.Value), nil
+}
+
+// Returns true if every key of the document is an operator
+func isOperatorDocument(doc bson.D) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for _, elem := range doc {
+		if !strings.HasPrefix(elem.Key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the values found at a path satisfy every operator in the condition
+func matchOperators(values []any, condition bson.D) (bool, error) {
+	for _, elem := range condition {
+		ok, err := matchOperator(values, elem.Key, elem.Value, condition)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Returns true if the values found at a path satisfy the operator
+func matchOperator(values []any, operator string, arg any, condition bson.D) (bool, error) {
+	switch operator {
+	case "$eq":
+		return matchEquality(values, arg), nil
+	case "$ne":
+		return !matchEquality(values, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, value := range expandArrays(values) {
+			if typeOrder(value) != typeOrder(arg) {
+				continue
+			}
+			cmp := compareValues(value, arg)
+			if (operator == "$gt" && cmp > 0) || (operator == "$gte" && cmp >= 0) ||
+				(operator == "$lt" && cmp < 0) || (operator == "$lte" && cmp <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$in", "$nin":
+		options, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array", operator)
+		}
+		found := false
+		for _, option := range options {
+			if matchEquality(values, option) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$exists":
+		return truthy(arg) == (len(values) > 0), nil
+	case "$regex":
+		var flags string
+		if options, ok := lookupKey(condition, "$options"); ok {
+			flags, _ = options.(string)
+		}
+		re, err := compileRegex(arg, flags)
+		if err != nil {
+			return false, err
+		}
+		return matchRegex(values, re), nil
+	case "$options":
+		return true, nil
+	case "$not":
+		if inner, ok := arg.(bson.D); ok {
+			matched, err := matchOperators(values, inner)
+			return !matched, err
+		}
+		re, err := compileRegex(arg, "")
+		if err != nil {
+			return false, fmt.Errorf("$not needs a document or a regex")
+		}
+		return !matchRegex(values, re), nil
+	case "$size":
+		size, ok := toFloat(arg)
+		if !ok {
+			return false, fmt.Errorf("$size needs a number")
+		}
+		for _, value := range values {
+			if array, ok := value.(bson.A); ok && float64(len(array)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		required, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("$all needs an array")
+		}
+		for _, option := range required {
+			if !matchEquality(values, option) {
+				return false, nil
+			}
+		}
+		return len(required) > 0, nil
+	case "$elemMatch":
+		query, ok := arg.(bson.D)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch needs a document")
+		}
+		for _, value := range values {
+			array, ok := value.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, item := range array {
+				var matched bool
+				var err error
+				if isOperatorDocument(query) {
+					matched, err = matchOperators([]any{item}, query)
+				} else if doc, ok := item.(bson.D); ok {
+					matched, err = matchDocument(doc, query)
+				}
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$near", "$nearSphere":
+		near, err := parseNear(arg)
+		if err != nil {
+			return false, err
+		}
+		return near.matches(values), nil
+	case "$geoWithin":
+		return matchGeoWithin(values, arg)
+	}
+	return false, fmt.Errorf("%w: query operator %s", ErrNotSupportedInMemory, operator)
+}
+
+// Returns true if any of the values equals the target
+// Arrays match if they equal the target or contain it, and a nil target matches a missing field
+func matchEquality(values []any, target any) bool {
+	if target == nil {
+		if len(values) == 0 {
+			return true
+		}
+	}
+	if _, ok := target.(bson.Regex); ok {
+		re, err := compileRegex(target, "")
+		return err == nil && matchRegex(values, re)
+	}
+	for _, value := range expandArrays(values) {
+		if equalValues(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if any of the string values matches the regex
+func matchRegex(values []any, re *regexp.Regexp) bool {
+	for _, value := range expandArrays(values) {
+		if s, ok := value.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compiles a regex given as a string or bson.Regex using MongoDB's option letters
+func compileRegex(pattern any, flags string) (*regexp.Regexp, error) {
+	switch p := pattern.(type) {
+	case string:
+		return compileRegexFlags(p, flags)
+	case bson.Regex:
+		if flags == "" {
+			flags = p.Options
+		}
+		return compileRegexFlags(p.Pattern, flags)
+	}
+	return nil, fmt.Errorf("$regex needs a string or regex, got %T", pattern)
+}
+
+func compileRegexFlags(pattern string, flags string) (*regexp.Regexp, error) {
+	goFlags := ""
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 'm', 's':
+			goFlags += string(flag)
+		}
+	}
+	if goFlags != "" {
+		pattern = "(?" + goFlags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// Returns the values plus the elements of any arrays among them
+func expandArrays(values []any) []any {
+	expanded := values
+	for _, value := range values {
+		if array, ok := value.(bson.A); ok {
+			expanded = append(expanded[:len(expanded):len(expanded)], array...)
+		}
+	}
+	return expanded
+}
+
+// Returns every value found at the dotted path
+// Arrays of documents along the way are searched element by element, as MongoDB does
+func resolvePath(value any, path string) []any {
+	return resolveParts(value, strings.Split(path, "."))
+}
+
+func resolveParts(value any, parts []string) []any {
+	if len(parts) == 0 {
+		return []any{value}
+	}
+	switch v := value.(type) {
+	case bson.D:
+		child, ok := lookupKey(v, parts[0])
+		if !ok {
+			return nil
+		}
+		return resolveParts(child, parts[1:])
+	case bson.A:
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index >= 0 && index < len(v) {
+				return resolveParts(v[index], parts[1:])
+			}
+			return nil
+		}
+		var found []any
+		for _, item := range v {
+			if _, ok := item.(bson.D); ok {
+				found = append(found, resolveParts(item, parts)...)
+			}
+		}
+		return found
+	}
+	return nil
+}
+
+// Returns the value of a key in a document
+func lookupKey(doc bson.D, key string) (any, bool) {
+	for _, elem := range doc {
+		if elem.Key == key {
+			return elem.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the single value at a dotted path without searching inside arrays of documents
+func getPath(doc bson.D, path string) (any, bool) {
+	var value any = doc
+	for _, part := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case bson.D:
+			child, ok := lookupKey(v, part)
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case bson.A:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Returns true if the value counts as true for operators like $exists
+func truthy(value any) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	if f, ok := toFloat(value); ok {
+		return f != 0
+	}
+	return value != nil
+}
+
+// Converts any numeric BSON value to a float64
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Returns the position of the value's type in MongoDB's sort order
+func typeOrder(value any) int {
+	if _, ok := toFloat(value); ok {
+		return 2
+	}
+	switch value.(type) {
+	case nil, bson.Null, bson.Undefined:
+		return 1
+	case string, bson.Symbol:
+		return 3
+	case bson.D, bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case bson.Binary, []byte:
+		return 6
+	case bson.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case bson.DateTime:
+		return 9
+	case bson.Timestamp:
+		return 10
+	case bson.Regex:
+		return 11
+	}
+	return 12
+}
+
+// Compares two values using MongoDB's ordering, returning -1, 0 or 1
+func compareValues(a any, b any) int {
+	orderA, orderB := typeOrder(a), typeOrder(b)
+	if orderA != orderB {
+		return compareInts(int64(orderA), int64(orderB))
+	}
+	switch orderA {
+	case 2:
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		if x64, ok := a.(int64); ok {
+			if y64, ok := b.(int64); ok {
+				return compareInts(x64, y64)
+			}
+		}
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return compareInts(boolInt(!math.IsNaN(x)), boolInt(!math.IsNaN(y)))
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+		return 0
+	case 3:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	case 4:
+		x, _ := toDocument(a)
+		y, _ := toDocument(b)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if cmp := strings.Compare(x[i].Key, y[i].Key); cmp != 0 {
+				return cmp
+			}
+			if cmp := compareValues(x[i].Value, y[i].Value); cmp != 0 {
+				return cmp
+			}
+		}
+		return compareInts(int64(len(x)), int64(len(y)))
+	case 5:
+		x, y := a.(bson.A), b.(bson.A)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if cmp := compareValues(x[i], y[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		return compareInts(int64(len(x)), int64(len(y)))
+	case 7:
+		x, y := a.(bson.ObjectID), b.(bson.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case 8:
+		return compareInts(boolInt(a.(bool)), boolInt(b.(bool)))
+	case 9:
+		return compareInts(int64(a.(bson.DateTime)), int64(b.(bson.DateTime)))
+	case 10:
+		x, y := a.(bson.Timestamp), b.(bson.Timestamp)
+		if x.T != y.T {
+			return compareInts(int64(x.T), int64(y.T))
+		}
+		return compareInts(int64(x.I), int64(y.I))
+	}
+	if equalValues(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// Returns true if the values are equal, numbers of different types are equal if their values are
+func equalValues(a any, b any) bool {
+	if typeOrder(a) != typeOrder(b) {
+		return false
+	}
+	switch typeOrder(a) {
+	case 1:
+		return true
+	case 2, 3, 4, 5, 7, 8, 9, 10:
+		return compareValues(a, b) == 0
+	}
+	aBytes, aErr := bson.Marshal(bson.D{{Key: "v", Value: a}})
+	bBytes, bErr := bson.Marshal(bson.D{{Key: "v", Value: b}})
+	return aErr == nil && bErr == nil && bytes.Equal(aBytes, bBytes)
+}
+
+func compareInts(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Sorts the documents in place using a sort specification such as bson.D{{"Age", -1}}
+func sortDocuments(docs []bson.D, spec any) error {
+	keys, err := toDocument(spec)
+	if err != nil {
+		return fmt.Errorf("invalid sort: %w", err)
+	}
+	directions := make([]int, len(keys))
+	for i, key := range keys {
+		direction, ok := toFloat(key.Value)
+		if !ok || (direction != 1 && direction != -1) {
+			return fmt.Errorf("%w: sort on %s by %v", ErrNotSupportedInMemory, key.Key, key.Value)
+		}
+		directions[i] = int(direction)
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for k, key := range keys {
+			cmp := compareValues(sortValue(docs[i], key.Key, directions[k]), sortValue(docs[j], key.Key, directions[k]))
+			if cmp != 0 {
+				return cmp*directions[k] < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// Returns the value a document is sorted by
+// Arrays sort by their smallest element ascending and their largest descending
+func sortValue(doc bson.D, path string, direction int) any {
+	values := resolvePath(doc, path)
+	var best any
+	found := false
+	for _, value := range expandArrays(values) {
+		if _, ok := value.(bson.A); ok {
+			continue
+		}
+		if !found || compareValues(value, best)*direction < 0 {
+			best = value
+			found = true
+		}
+	}
+	return best
+}
+
+// Applies an inclusion or exclusion projection to the document
+func project(doc bson.D, projection any) (bson.D, error) {
+	if projection == nil {
+		return doc, nil
+	}
+	spec, err := toDocument(projection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection: %w", err)
+	}
+	if len(spec) == 0 {
+		return doc, nil
+	}
+	include := false
+	excludeId := false
+	for _, elem := range spec {
+		if _, ok := elem.Value.(bson.D); ok {
+			return nil, fmt.Errorf("%w: projection operator on %s", ErrNotSupportedInMemory, elem.Key)
+		}
+		if elem.Key == "_id" {
+			excludeId = !truthy(elem.Value)
+			continue
+		}
+		if truthy(elem.Value) {
+			include = true
+		}
+	}
+	if !include {
+		projected := copyDocument(doc)
+		for _, elem := range spec {
+			if !truthy(elem.Value) {
+				projected = unsetPath(projected, elem.Key)
+			}
+		}
+		return projected, nil
+	}
+	projected := bson.D{}
+	if id, ok := lookupKey(doc, "_id"); ok && !excludeId {
+		projected = append(projected, bson.E{Key: "_id", Value: id})
+	}
+	for _, elem := range spec {
+		if elem.Key == "_id" || !truthy(elem.Value) {
+			continue
+		}
+		if value, ok := getPath(doc, elem.Key); ok {
+			updated, err := setPath(projected, elem.Key, copyValue(value))
+			if err != nil {
+				return nil, err
+			}
+			projected = updated
+		}
+	}
+	return projected, nil
+}
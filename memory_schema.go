@@ -0,0 +1,255 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// The error code MongoDB gives when a collection doesn't exist
+const namespaceNotFound = 26
+
+// The error code MongoDB gives when a write doesn't pass the collection's validator
+const documentValidationFailure = 121
+
+// Returns the options bark sets on collections: capping and validation
+func (c *memoryCollection) Specification(ctx context.Context) (*mongo.CollectionSpecification, error) {
+	defer c.lock(ctx)()
+	if c.options == nil && len(c.docs) == 0 {
+		return nil, nil
+	}
+	opts := bson.D{}
+	if o := c.options; o != nil {
+		if o.Capped != nil && *o.Capped {
+			opts = append(opts, bson.E{Key: "capped", Value: true})
+			if o.SizeInBytes != nil {
+				opts = append(opts, bson.E{Key: "size", Value: *o.SizeInBytes})
+			}
+			if o.MaxDocuments != nil {
+				opts = append(opts, bson.E{Key: "max", Value: *o.MaxDocuments})
+			}
+		}
+		if o.Validator != nil {
+			level, action := c.validation()
+			opts = append(opts,
+				bson.E{Key: "validator", Value: o.Validator},
+				bson.E{Key: "validationLevel", Value: level},
+				bson.E{Key: "validationAction", Value: action})
+		}
+	}
+	raw, err := bson.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.CollectionSpecification{Name: c.name, Type: "collection", Options: raw}, nil
+}
+
+// Changes the validator, validation level and validation action, other changes aren't supported
+func (c *memoryCollection) ModifyCollection(ctx context.Context, changes bson.D) error {
+	defer c.lock(ctx)()
+	if c.options == nil {
+		if len(c.docs) == 0 {
+			return mongo.CommandError{Code: namespaceNotFound, Name: "NamespaceNotFound", Message: "ns does not exist"}
+		}
+		c.options = &options.CreateCollectionOptions{}
+	}
+	// The changes are applied to a copy so a bad change leaves the options as they were
+	opts := *c.options
+	for _, change := range changes {
+		switch change.Key {
+		case "validator":
+			opts.Validator = change.Value
+		case "validationLevel":
+			level := fmt.Sprint(change.Value)
+			opts.ValidationLevel = &level
+		case "validationAction":
+			action := fmt.Sprint(change.Value)
+			opts.ValidationAction = &action
+		default:
+			return fmt.Errorf("%w: collMod %s", ErrNotSupportedInMemory, change.Key)
+		}
+	}
+	c.options = &opts
+	return nil
+}
+
+// Returns the validation level and action, with MongoDB's defaults, the caller must hold the lock
+func (c *memoryCollection) validation() (string, string) {
+	level, action := "strict", "error"
+	if c.options.ValidationLevel != nil {
+		level = *c.options.ValidationLevel
+	}
+	if c.options.ValidationAction != nil {
+		action = *c.options.ValidationAction
+	}
+	return level, action
+}
+
+// Checks a document being written against the collection's validator, the caller must hold the lock
+// Before is nil for inserts, with the moderate level documents that were already invalid can still be updated
+func (c *memoryCollection) validate(before bson.D, after bson.D) error {
+	if c.options == nil || c.options.Validator == nil {
+		return nil
+	}
+	level, action := c.validation()
+	if level == "off" || action == "warn" {
+		return nil
+	}
+	validator, err := toDocument(c.options.Validator)
+	if err != nil {
+		return fmt.Errorf("invalid validator: %w", err)
+	}
+	if level == "moderate" && before != nil {
+		if ok, err := matchDocument(before, validator); err != nil || !ok {
+			return err
+		}
+	}
+	ok, err := matchDocument(after, validator)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+			Code:    documentValidationFailure,
+			Message: "Document failed validation",
+		}}}
+	}
+	return nil
+}
+
+// Returns true if the value matches the JSON Schema
+// Supports bsonType, required, properties, additionalProperties, enum and items
+func matchSchema(value any, schema bson.D) (bool, error) {
+	for _, keyword := range schema {
+		ok := true
+		switch keyword.Key {
+		case "bsonType":
+			ok = matchBsonType(value, keyword.Value)
+		case "enum":
+			values, _ := keyword.Value.(bson.A)
+			ok = containsValue(values, value)
+		case "required":
+			doc, isDoc := value.(bson.D)
+			names, _ := keyword.Value.(bson.A)
+			for _, name := range names {
+				if _, found := lookupKey(doc, fmt.Sprint(name)); isDoc && !found {
+					ok = false
+				}
+			}
+		case "properties":
+			doc, isDoc := value.(bson.D)
+			properties, err := toDocument(keyword.Value)
+			if err != nil || !isDoc {
+				break
+			}
+			for _, property := range properties {
+				field, found := lookupKey(doc, property.Key)
+				if !found {
+					continue
+				}
+				subschema, err := toDocument(property.Value)
+				if err != nil {
+					return false, fmt.Errorf("invalid schema for %s: %w", property.Key, err)
+				}
+				if matched, err := matchSchema(field, subschema); err != nil || !matched {
+					return false, err
+				}
+			}
+		case "additionalProperties":
+			doc, isDoc := value.(bson.D)
+			allowed, _ := keyword.Value.(bool)
+			if !isDoc || allowed {
+				break
+			}
+			properties, _ := lookupKey(schema, "properties")
+			declared, _ := toDocument(properties)
+			for _, elem := range doc {
+				if _, found := lookupKey(declared, elem.Key); !found {
+					ok = false
+				}
+			}
+		case "items":
+			items, isArray := value.(bson.A)
+			subschema, err := toDocument(keyword.Value)
+			if err != nil || !isArray {
+				break
+			}
+			for _, item := range items {
+				if matched, err := matchSchema(item, subschema); err != nil || !matched {
+					return false, err
+				}
+			}
+		case "title", "description":
+		default:
+			return false, fmt.Errorf("%w: $jsonSchema keyword %s", ErrNotSupportedInMemory, keyword.Key)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Returns true if the value has the BSON type, or one of the types if given an array
+func matchBsonType(value any, types any) bool {
+	names, ok := types.(bson.A)
+	if !ok {
+		names = bson.A{types}
+	}
+	actual := bsonTypeOf(value)
+	for _, name := range names {
+		switch name {
+		case actual:
+			return true
+		case "number":
+			if actual == "int" || actual == "long" || actual == "double" || actual == "decimal" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the BSON type alias of a value, like "string" or "objectId"
+func bsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil, bson.Null:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int32, int8, int16, uint8, uint16:
+		return "int"
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return "int"
+		}
+		return "long"
+	case int64, uint32, uint64, uint:
+		return "long"
+	case float64, float32:
+		return "double"
+	case bson.Decimal128:
+		return "decimal"
+	case bson.D, bson.M:
+		return "object"
+	case bson.A:
+		return "array"
+	case bson.Binary, []byte:
+		return "binData"
+	case bson.ObjectID:
+		return "objectId"
+	case bson.DateTime:
+		return "date"
+	case bson.Regex:
+		return "regex"
+	case bson.Timestamp:
+		return "timestamp"
+	}
+	return ""
+}
@@ -0,0 +1,291 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Prepares a context that uses a fresh in-memory database instead of MongoDB
+func setupMemoryTest(name string, now string, t *testing.T) context.Context {
+	ctx := setupTest(name, now, t)
+	return bark.WithMemoryDb(ctx, bark.NewMemoryDb())
+}
+func TestMemoryFind(t *testing.T) {
+	ctx := setupMemoryTest("MemoryFind", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{
+		{Name: "Fido", Id: "1111", Age: 3},
+		{Name: "Spot", Id: "2222", Age: 5},
+		{Name: "Rex", Id: "3333", Age: 3},
+		{Name: "Max", Id: "4444", Age: 7},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	names := func(results []*Dog) []string {
+		var names []string
+		for _, dog := range results {
+			names = append(names, dog.Name)
+		}
+		return names
+	}
+	tests := []struct {
+		name   string
+		filter bson.M
+		opts   *options.FindOptionsBuilder
+		want   []string
+	}{
+		{"equality", bson.M{"Age": 3}, nil, []string{"Fido", "Rex"}},
+		{"comparison", bson.M{"Age": bson.M{"$gt": 3, "$lte": 7}}, nil, []string{"Spot", "Max"}},
+		{"$in", bson.M{"Name": bson.M{"$in": []string{"Max", "Fido"}}}, nil, []string{"Fido", "Max"}},
+		{"$nin", bson.M{"Name": bson.M{"$nin": []string{"Max", "Fido"}}}, nil, []string{"Spot", "Rex"}},
+		{"$ne", bson.M{"Age": bson.M{"$ne": 3}}, nil, []string{"Spot", "Max"}},
+		{"$or", bson.M{"$or": []bson.M{{"Age": 7}, {"Name": "Fido"}}}, nil, []string{"Fido", "Max"}},
+		{"$regex", bson.M{"Name": bson.M{"$regex": "^[rs]", "$options": "i"}}, nil, []string{"Spot", "Rex"}},
+		{"$exists", bson.M{"Weight": bson.M{"$exists": false}, "Age": 5}, nil, []string{"Spot"}},
+		{"$not", bson.M{"Age": bson.M{"$not": bson.M{"$lt": 5}}}, nil, []string{"Spot", "Max"}},
+		{"sort", bson.M{}, options.Find().SetSort(bson.D{{Key: "Age", Value: -1}, {Key: "Name", Value: 1}}), []string{"Max", "Spot", "Fido", "Rex"}},
+		{"skip and limit", bson.M{}, options.Find().SetSort(bson.M{"Name": 1}).SetSkip(1).SetLimit(2), []string{"Max", "Rex"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := dogs.Find(test.filter, test.opts, ctx)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			got := names(results)
+			if len(got) != len(test.want) {
+				t.Fatalf("Expected %v, got %v", test.want, got)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("Expected %v, got %v", test.want, got)
+				}
+			}
+		})
+	}
+
+	t.Run("Unsupported operators fail loudly", func(t *testing.T) {
+		_, err := dogs.Find(bson.M{"$where": "this.Age > 3"}, nil, ctx)
+		if !errors.Is(err, bark.ErrNotSupportedInMemory) {
+			t.Errorf("Expected ErrNotSupportedInMemory, got %v", err)
+		}
+	})
+	t.Run("Databases are isolated", func(t *testing.T) {
+		other := bark.WithMemoryDb(ctx, bark.NewMemoryDb())
+		count, err := dogs.Count(bson.M{}, other)
+		if err != nil || count != 0 {
+			t.Errorf("Expected empty database, got %d and %v", count, err)
+		}
+	})
+}
+func TestMemorySaveModel(t *testing.T) {
+	ctx := setupMemoryTest("MemorySaveModel", "2024-03-27T19:55:38.782Z", t)
+	dogs := bark.NewCollection[*Dog](DogCollectionName)
+
+	fido := NewDog("Fido")
+	result, err := fido.Save(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Inserted != 1 {
+		t.Errorf("Expected 1 inserted, got %d", result.Inserted)
+	}
+	fido.Age = 4
+	result, err = fido.Save(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Matched != 1 || result.Modified != 1 {
+		t.Errorf("Expected 1 matched and modified, got %s", result.String())
+	}
+	copy, err := dogs.Get(fido.Id, ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if copy.Age != 4 || copy.Version != 2 || copy.ID != fido.Id {
+		t.Errorf("Expected age 4 at version 2, got %s at version %d", copy.String(), copy.Version)
+	}
+	if !copy.CreatedOn.Equal(bark.Now(ctx)) {
+		t.Errorf("Expected CreatedOn to be set on insert, got %v", copy.CreatedOn)
+	}
+	result, err = fido.Delete(ctx)
+	if err != nil || result.Deleted != 1 {
+		t.Errorf("Expected 1 deleted, got %v and %v", result, err)
+	}
+}
+func TestMemoryUpdates(t *testing.T) {
+	ctx := setupMemoryTest("MemoryUpdates", "2024-03-27T19:55:38.782Z", t)
+	backend, err := bark.NewCollection[*Dog]("dogs").Backend(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	backend.InsertOne(ctx, bson.M{"_id": "1", "Name": "Fido", "Age": 3, "Tags": bson.A{"good"}, "Toy": "ball"})
+
+	t.Run("Applies update operators", func(t *testing.T) {
+		update := bson.M{
+			"$set":   bson.M{"Owner.Name": "Ann"},
+			"$inc":   bson.M{"Age": 1},
+			"$unset": bson.M{"Toy": ""},
+			"$push":  bson.M{"Tags": bson.M{"$each": bson.A{"loyal", "fast"}}},
+		}
+		result, err := backend.UpdateOne(ctx, bson.M{"_id": "1"}, update, nil)
+		if err != nil || result.ModifiedCount != 1 {
+			t.Fatalf("Expected 1 modified, got %v and %v", result, err)
+		}
+		var doc bson.M
+		raw, _ := backend.FindOne(ctx, bson.M{"Owner.Name": "Ann", "Tags": "fast", "Toy": nil}, nil)
+		bson.Unmarshal(raw, &doc)
+		if doc["Age"] != int32(4) {
+			t.Errorf("Expected age 4, got %v", doc["Age"])
+		}
+		if tags, _ := doc["Tags"].(bson.A); len(tags) != 3 {
+			t.Errorf("Expected 3 tags, got %v", doc["Tags"])
+		}
+	})
+	t.Run("Upserts from the filter and $setOnInsert", func(t *testing.T) {
+		opts := options.UpdateOne().SetUpsert(true)
+		update := bson.M{"$set": bson.M{"Name": "Spot"}, "$setOnInsert": bson.M{"Age": 1}}
+		result, err := backend.UpdateOne(ctx, bson.M{"Id": "2"}, update, opts)
+		if err != nil || result.UpsertedCount != 1 {
+			t.Fatalf("Expected 1 upserted, got %v and %v", result, err)
+		}
+		count, _ := backend.CountDocuments(ctx, bson.M{"Id": "2", "Name": "Spot", "Age": 1})
+		if count != 1 {
+			t.Errorf("Expected upserted document to have the filter and insert fields")
+		}
+		update = bson.M{"$set": bson.M{"Name": "Spotty"}, "$setOnInsert": bson.M{"Age": 9}}
+		result, _ = backend.UpdateOne(ctx, bson.M{"Id": "2"}, update, opts)
+		if result.MatchedCount != 1 || result.UpsertedCount != 0 {
+			t.Errorf("Expected existing document to be matched, got %v", result)
+		}
+		count, _ = backend.CountDocuments(ctx, bson.M{"Name": "Spotty", "Age": 1})
+		if count != 1 {
+			t.Errorf("Expected $setOnInsert to be ignored on update")
+		}
+	})
+	t.Run("Rejects duplicate ids", func(t *testing.T) {
+		_, err := backend.InsertOne(ctx, bson.M{"_id": "1"})
+		if !mongo.IsDuplicateKeyError(err) {
+			t.Errorf("Expected a duplicate key error, got %v", err)
+		}
+	})
+	t.Run("Projects fields", func(t *testing.T) {
+		raw, err := backend.FindOne(ctx, bson.M{"_id": "1"}, options.FindOne().SetProjection(bson.M{"Name": 1, "_id": 0}))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var doc bson.M
+		bson.Unmarshal(raw, &doc)
+		if len(doc) != 1 || doc["Name"] != "Fido" {
+			t.Errorf("Expected only the name, got %v", doc)
+		}
+	})
+}
+func TestMemoryTransaction(t *testing.T) {
+	ctx := setupMemoryTest("MemoryTransaction", "2024-03-27T19:55:38.782Z", t)
+	dogs, _ := SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}}, ctx)
+	failure := errors.New("failure")
+	err := bark.WithTransaction(ctx, func(txCtx context.Context) error {
+		if !bark.InTransaction(txCtx) {
+			t.Error("Expected callback context to be in a transaction")
+		}
+		NewDog("Spot").Save(txCtx)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected callback error, got %v", err)
+	}
+	count, _ := dogs.Count(bson.M{}, ctx)
+	if count != 1 {
+		t.Errorf("Expected the write to be rolled back, got %d dogs", count)
+	}
+
+	t.Run("Keeps writes made outside the transaction", func(t *testing.T) {
+		saved := make(chan error)
+		bark.WithTransaction(ctx, func(txCtx context.Context) error {
+			go func() {
+				_, err := NewDog("Rex").Save(ctx)
+				saved <- err
+			}()
+			time.Sleep(20 * time.Millisecond)
+			NewDog("Spot").Save(txCtx)
+			return failure
+		})
+		if err := <-saved; err != nil {
+			t.Fatalf("Expected the save outside the transaction to succeed, got %v", err)
+		}
+		names, _ := bark.Distinct[string](dogs, "Name", bson.M{}, ctx)
+		if len(names) != 2 || !slices.Contains(names, "Rex") {
+			t.Errorf("Expected Fido and Rex, got %v", names)
+		}
+	})
+}
+func TestUseMemoryDb(t *testing.T) {
+	ctx := setupTest("UseMemoryDb", "2024-03-27T19:55:38.782Z", t)
+	bark.UseMemoryDb("test-UseMemoryDb", bark.NewMemoryDb())
+	defer bark.UseMemoryDb("test-UseMemoryDb", nil)
+	if _, err := NewDog("Fido").Save(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	count, err := bark.NewCollection[*Dog](DogCollectionName).Count(bson.M{}, ctx)
+	if err != nil || count != 1 {
+		t.Errorf("Expected 1 dog in the registered memory database, got %d and %v", count, err)
+	}
+}
+
+func TestMemoryAggregate(t *testing.T) {
+	ctx := setupMemoryTest("MemoryAggregate", "2024-03-27T19:55:38.782Z", t)
+	insertAll("pets", ctx, t,
+		bson.M{"_id": "p1", "Name": "Fido", "ToyIds": bson.A{"t1", "t2"}},
+		bson.M{"_id": "p2", "Name": "Spot", "ToyIds": bson.A{}},
+		bson.M{"_id": "p3", "Name": "Rex", "ToyIds": bson.A{"t3"}})
+	backend, _ := bark.NewCollection[*Pet]("pets").Backend(ctx)
+	run := func(pipeline mongo.Pipeline) []bson.M {
+		cursor, err := backend.Aggregate(ctx, pipeline)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var results []bson.M
+		for cursor.Next(ctx) {
+			doc := bson.M{}
+			bson.Unmarshal(cursor.Current(), &doc)
+			results = append(results, doc)
+		}
+		return results
+	}
+	t.Run("Unwinds, pages and projects", func(t *testing.T) {
+		results := run(mongo.Pipeline{
+			{{Key: "$unwind", Value: "$ToyIds"}},
+			{{Key: "$sort", Value: bson.D{{Key: "ToyIds", Value: -1}}}},
+			{{Key: "$skip", Value: 1}},
+			{{Key: "$limit", Value: 1}},
+			{{Key: "$project", Value: bson.D{{Key: "ToyIds", Value: 1}, {Key: "_id", Value: 0}}}},
+		})
+		if len(results) != 1 || results[0]["ToyIds"] != "t2" || results[0]["_id"] != nil {
+			t.Errorf("Expected only t2, got %v", results)
+		}
+	})
+	t.Run("Counts", func(t *testing.T) {
+		results := run(mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{{Key: "Name", Value: bson.D{{Key: "$ne", Value: "Rex"}}}}}},
+			{{Key: "$count", Value: "n"}},
+		})
+		if len(results) != 1 || results[0]["n"] != int32(2) {
+			t.Errorf("Expected a count of 2, got %v", results)
+		}
+	})
+	t.Run("Unsupported stages fail loudly", func(t *testing.T) {
+		_, err := backend.Aggregate(ctx, mongo.Pipeline{{{Key: "$out", Value: "elsewhere"}}})
+		if !errors.Is(err, bark.ErrNotSupportedInMemory) {
+			t.Errorf("Expected ErrNotSupportedInMemory, got %v", err)
+		}
+	})
+}
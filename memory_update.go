@@ -0,0 +1,320 @@
+package bark
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Applies update operators to the document
+// Inserting is true when the document is being created by an upsert, which enables $setOnInsert
+func applyUpdate(doc bson.D, update bson.D, inserting bool) (bson.D, error) {
+	var err error
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a document", op.Key)
+		}
+		for _, field := range fields {
+			if field.Key == "_id" && op.Key != "$setOnInsert" && !(op.Key == "$set" && inserting) {
+				if current, ok := lookupKey(doc, "_id"); !ok || !equalValues(current, field.Value) {
+					return nil, fmt.Errorf("the _id field cannot be changed")
+				}
+			}
+			doc, err = applyOperator(doc, op.Key, field.Key, field.Value, inserting)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+// Applies a single update operator to one field of the document
+func applyOperator(doc bson.D, operator string, path string, arg any, inserting bool) (bson.D, error) {
+	current, exists := getPath(doc, path)
+	switch operator {
+	case "$set":
+		return setPath(doc, path, copyValue(arg))
+	case "$setOnInsert":
+		if !inserting {
+			return doc, nil
+		}
+		return setPath(doc, path, copyValue(arg))
+	case "$unset":
+		return unsetPath(doc, path), nil
+	case "$inc":
+		if !exists {
+			return setPath(doc, path, arg)
+		}
+		sum, err := addNumbers(current, arg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot $inc %s: %w", path, err)
+		}
+		return setPath(doc, path, sum)
+	case "$min", "$max":
+		cmp := compareValues(arg, current)
+		if !exists || (operator == "$min" && cmp < 0) || (operator == "$max" && cmp > 0) {
+			return setPath(doc, path, copyValue(arg))
+		}
+		return doc, nil
+	case "$push", "$addToSet":
+		items := bson.A{arg}
+		if each, ok := arg.(bson.D); ok {
+			if values, ok := lookupKey(each, "$each"); ok {
+				if items, ok = values.(bson.A); !ok {
+					return nil, fmt.Errorf("$each needs an array")
+				}
+			}
+		}
+		var array bson.A
+		if exists {
+			existing, ok := current.(bson.A)
+			if !ok {
+				return nil, fmt.Errorf("cannot %s to non-array field %s", operator, path)
+			}
+			array = append(bson.A{}, existing...)
+		}
+		for _, item := range items {
+			if operator == "$addToSet" && containsValue(array, item) {
+				continue
+			}
+			array = append(array, copyValue(item))
+		}
+		return setPath(doc, path, array)
+	case "$pull":
+		if !exists {
+			return doc, nil
+		}
+		array, ok := current.(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("cannot $pull from non-array field %s", path)
+		}
+		kept := bson.A{}
+		for _, item := range array {
+			var remove bool
+			if condition, ok := arg.(bson.D); ok && isOperatorDocument(condition) {
+				matched, err := matchOperators([]any{item}, condition)
+				if err != nil {
+					return nil, err
+				}
+				remove = matched
+			} else {
+				remove = equalValues(item, arg)
+			}
+			if !remove {
+				kept = append(kept, item)
+			}
+		}
+		return setPath(doc, path, kept)
+	}
+	return nil, fmt.Errorf("%w: update operator %s", ErrNotSupportedInMemory, operator)
+}
+
+// Returns true if the array holds a value equal to the item
+func containsValue(array bson.A, item any) bool {
+	for _, value := range array {
+		if equalValues(value, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds two numbers, keeping integer types unless a double is involved
+func addNumbers(a any, b any) (any, error) {
+	x, okA := toFloat(a)
+	y, okB := toFloat(b)
+	if !okA || !okB {
+		return nil, fmt.Errorf("both values must be numbers")
+	}
+	_, aDouble := a.(float64)
+	_, bDouble := b.(float64)
+	if aDouble || bDouble {
+		return x + y, nil
+	}
+	sum := int64(x) + int64(y)
+	_, aLong := a.(int64)
+	_, bLong := b.(int64)
+	if !aLong && !bLong && sum >= math.MinInt32 && sum <= math.MaxInt32 {
+		return int32(sum), nil
+	}
+	return sum, nil
+}
+
+// Builds the document inserted by an upsert from the equality conditions in the filter and the update
+func upsertDocument(filter any, changes bson.D, replace bool) (bson.D, error) {
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.D{}
+	if replace {
+		if id, ok := equalityValue(query, "_id"); ok {
+			doc = append(doc, bson.E{Key: "_id", Value: id})
+		}
+		for _, elem := range changes {
+			if elem.Key != "_id" || len(doc) == 0 {
+				doc = append(doc, elem)
+			}
+		}
+		return doc, nil
+	}
+	doc, err = seedFromQuery(doc, query)
+	if err != nil {
+		return nil, err
+	}
+	return applyUpdate(doc, changes, true)
+}
+
+// Copies the equality conditions of a query, including those inside $and, into the document
+func seedFromQuery(doc bson.D, query bson.D) (bson.D, error) {
+	var err error
+	for _, elem := range query {
+		if elem.Key == "$and" {
+			clauses, _ := elem.Value.(bson.A)
+			for _, clause := range clauses {
+				if clauseDoc, ok := clause.(bson.D); ok {
+					if doc, err = seedFromQuery(doc, clauseDoc); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+		if value, ok := equalityValue(query, elem.Key); ok && !strings.HasPrefix(elem.Key, "$") {
+			if doc, err = setPath(doc, elem.Key, copyValue(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+// Returns the value a query requires a field to equal, if it has one
+func equalityValue(query bson.D, key string) (any, bool) {
+	value, ok := lookupKey(query, key)
+	if !ok {
+		return nil, false
+	}
+	if condition, ok := value.(bson.D); ok && isOperatorDocument(condition) {
+		return lookupKey(condition, "$eq")
+	}
+	if _, ok := value.(bson.Regex); ok {
+		return nil, false
+	}
+	return value, true
+}
+
+// Replaces the document's contents while keeping its _id
+func replaceDocument(before bson.D, replacement bson.D) (bson.D, error) {
+	id, _ := lookupKey(before, "_id")
+	after := bson.D{{Key: "_id", Value: id}}
+	for _, elem := range replacement {
+		if elem.Key == "_id" {
+			if !equalValues(elem.Value, id) {
+				return nil, fmt.Errorf("the _id field cannot be changed")
+			}
+			continue
+		}
+		after = append(after, bson.E{Key: elem.Key, Value: copyValue(elem.Value)})
+	}
+	return after, nil
+}
+
+// Sets the value at a dotted path, creating documents along the way
+func setPath(doc bson.D, path string, value any) (bson.D, error) {
+	updated, err := setParts(doc, strings.Split(path, "."), value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set %s: %w", path, err)
+	}
+	return updated.(bson.D), nil
+}
+
+func setParts(container any, parts []string, value any) (any, error) {
+	key := parts[0]
+	switch c := container.(type) {
+	case bson.D:
+		for i, elem := range c {
+			if elem.Key != key {
+				continue
+			}
+			if len(parts) == 1 {
+				c[i].Value = value
+				return c, nil
+			}
+			child, err := setParts(elem.Value, parts[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			c[i].Value = child
+			return c, nil
+		}
+		if len(parts) == 1 {
+			return append(c, bson.E{Key: key, Value: value}), nil
+		}
+		child, err := setParts(bson.D{}, parts[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return append(c, bson.E{Key: key, Value: child}), nil
+	case bson.A:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("%s is not an array index", key)
+		}
+		for len(c) <= index {
+			c = append(c, nil)
+		}
+		if len(parts) == 1 {
+			c[index] = value
+			return c, nil
+		}
+		if c[index] == nil {
+			c[index] = bson.D{}
+		}
+		child, err := setParts(c[index], parts[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		c[index] = child
+		return c, nil
+	}
+	return nil, fmt.Errorf("field %s is inside a %T", key, container)
+}
+
+// Removes the value at a dotted path, array elements are set to null as MongoDB does
+func unsetPath(doc bson.D, path string) bson.D {
+	return unsetParts(doc, strings.Split(path, ".")).(bson.D)
+}
+
+func unsetParts(container any, parts []string) any {
+	key := parts[0]
+	switch c := container.(type) {
+	case bson.D:
+		for i, elem := range c {
+			if elem.Key != key {
+				continue
+			}
+			if len(parts) == 1 {
+				return append(c[:i:i], c[i+1:]...)
+			}
+			c[i].Value = unsetParts(elem.Value, parts[1:])
+			return c
+		}
+	case bson.A:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(c) {
+			return c
+		}
+		if len(parts) == 1 {
+			c[index] = nil
+			return c
+		}
+		c[index] = unsetParts(c[index], parts[1:])
+	}
+	return container
+}
@@ -0,0 +1,230 @@
+package bark
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// The date $dateTrunc counts bins from
+var dateTruncReference = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// The length of each $dateTrunc unit that has a fixed length
+var dateUnits = map[string]time.Duration{
+	"millisecond": time.Millisecond,
+	"second":      time.Second,
+	"minute":      time.Minute,
+	"hour":        time.Hour,
+	"day":         24 * time.Hour,
+}
+
+// Truncates a date to the start of its bin, as $dateTrunc does in UTC for units up to a day
+func dateTrunc(doc bson.D, arg any) (any, error) {
+	spec, ok := arg.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$dateTrunc needs a document")
+	}
+	dateExpr, _ := lookupKey(spec, "date")
+	value, err := evaluate(doc, dateExpr)
+	if err != nil {
+		return nil, err
+	}
+	date, ok := value.(bson.DateTime)
+	if !ok {
+		return nil, nil
+	}
+	unitValue, _ := lookupKey(spec, "unit")
+	unit, ok := dateUnits[fmt.Sprint(unitValue)]
+	if !ok {
+		return nil, fmt.Errorf("%w: $dateTrunc unit %v", ErrNotSupportedInMemory, unitValue)
+	}
+	binSize := 1.0
+	if value, ok := lookupKey(spec, "binSize"); ok {
+		if binSize, ok = toFloat(value); !ok || binSize < 1 {
+			return nil, fmt.Errorf("$dateTrunc binSize must be a positive number")
+		}
+	}
+	bin := time.Duration(binSize) * unit
+	since := date.Time().Sub(dateTruncReference)
+	start := since - since%bin
+	if since%bin < 0 {
+		start -= bin
+	}
+	return bson.NewDateTimeFromTime(dateTruncReference.Add(start)), nil
+}
+
+// Adds fields computed over windows of the documents in each partition, as $setWindowFields does
+// Supports documents and range windows with the $group accumulators
+func setWindowFields(docs []bson.D, arg any) ([]bson.D, error) {
+	spec, err := toDocument(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $setWindowFields: %w", err)
+	}
+	partitionBy, _ := lookupKey(spec, "partitionBy")
+	sortByValue, _ := lookupKey(spec, "sortBy")
+	sortBy, _ := sortByValue.(bson.D)
+	outputValue, _ := lookupKey(spec, "output")
+	output, ok := outputValue.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$setWindowFields needs an output document")
+	}
+	// Documents are partitioned, then each partition is sorted
+	type partition struct {
+		key  any
+		docs []bson.D
+	}
+	var partitions []*partition
+	for _, doc := range docs {
+		key, err := evaluate(doc, partitionBy)
+		if err != nil {
+			return nil, err
+		}
+		var found *partition
+		for _, p := range partitions {
+			if equalValues(p.key, key) {
+				found = p
+				break
+			}
+		}
+		if found == nil {
+			found = &partition{key: key}
+			partitions = append(partitions, found)
+		}
+		found.docs = append(found.docs, doc)
+	}
+	sort.SliceStable(partitions, func(i, j int) bool { return compareValues(partitions[i].key, partitions[j].key) < 0 })
+	var results []bson.D
+	for _, p := range partitions {
+		if sortBy != nil {
+			if err := sortDocuments(p.docs, sortBy); err != nil {
+				return nil, err
+			}
+		}
+		computed := make([]bson.D, len(p.docs))
+		for i := range p.docs {
+			computed[i] = copyDocument(p.docs[i])
+			for _, field := range output {
+				value, err := windowValue(p.docs, i, sortBy, field)
+				if err != nil {
+					return nil, err
+				}
+				if computed[i], err = setPath(computed[i], field.Key, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		results = append(results, computed...)
+	}
+	return results, nil
+}
+
+// Returns the value of an output field for the document at index i of its sorted partition
+func windowValue(docs []bson.D, i int, sortBy bson.D, field bson.E) (any, error) {
+	spec, ok := field.Value.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("$setWindowFields output %s needs a document", field.Key)
+	}
+	var window bson.D
+	operator := bson.D{}
+	for _, elem := range spec {
+		if elem.Key == "window" {
+			window, _ = elem.Value.(bson.D)
+			continue
+		}
+		operator = append(operator, elem)
+	}
+	if len(operator) == 1 && operator[0].Key == "$count" {
+		operator = bson.D{{Key: "$count", Value: bson.D{}}}
+	}
+	acc, err := newAccumulator(bson.E{Key: field.Key, Value: operator})
+	if err != nil {
+		return nil, err
+	}
+	lo, hi, err := windowBounds(docs, i, sortBy, window)
+	if err != nil {
+		return nil, err
+	}
+	for j := lo; j <= hi; j++ {
+		if err := acc.add(docs[j]); err != nil {
+			return nil, err
+		}
+	}
+	return acc.result(), nil
+}
+
+// Returns the first and last index of the window around the document at index i
+func windowBounds(docs []bson.D, i int, sortBy bson.D, window bson.D) (int, int, error) {
+	lo, hi := 0, len(docs)-1
+	if documents, ok := lookupKey(window, "documents"); ok {
+		bounds, ok := documents.(bson.A)
+		if !ok || len(bounds) != 2 {
+			return 0, 0, fmt.Errorf("window documents needs two bounds")
+		}
+		offset := func(bound any, unbounded int) (int, error) {
+			switch bound {
+			case "unbounded":
+				return unbounded, nil
+			case "current":
+				return i, nil
+			}
+			n, ok := toFloat(bound)
+			if !ok {
+				return 0, fmt.Errorf("invalid window bound %v", bound)
+			}
+			return i + int(n), nil
+		}
+		var err error
+		if lo, err = offset(bounds[0], 0); err != nil {
+			return 0, 0, err
+		}
+		if hi, err = offset(bounds[1], len(docs)-1); err != nil {
+			return 0, 0, err
+		}
+		return max(lo, 0), min(hi, len(docs)-1), nil
+	}
+	if rangeValue, ok := lookupKey(window, "range"); ok {
+		bounds, ok := rangeValue.(bson.A)
+		if !ok || len(bounds) != 2 || len(sortBy) != 1 {
+			return 0, 0, fmt.Errorf("window range needs two bounds and a single sort field")
+		}
+		scale := 1.0
+		if unitValue, ok := lookupKey(window, "unit"); ok {
+			unit, ok := dateUnits[fmt.Sprint(unitValue)]
+			if !ok {
+				return 0, 0, fmt.Errorf("%w: window unit %v", ErrNotSupportedInMemory, unitValue)
+			}
+			scale = float64(unit / time.Millisecond)
+		}
+		position := func(doc bson.D) (float64, bool) {
+			value, _ := getPath(doc, sortBy[0].Key)
+			if date, ok := value.(bson.DateTime); ok {
+				return float64(date), true
+			}
+			return toFloat(value)
+		}
+		current, ok := position(docs[i])
+		if !ok {
+			return 0, -1, nil
+		}
+		from, to := -1e308, 1e308
+		if bound, ok := toFloat(bounds[0]); ok {
+			from = current + bound*scale
+		} else if bounds[0] == "current" {
+			from = current
+		}
+		if bound, ok := toFloat(bounds[1]); ok {
+			to = current + bound*scale
+		} else if bounds[1] == "current" {
+			to = current
+		}
+		lo, hi = len(docs), -1
+		for j, doc := range docs {
+			if p, ok := position(doc); ok && p >= from && p <= to {
+				lo, hi = min(lo, j), max(hi, j)
+			}
+		}
+	}
+	return lo, hi, nil
+}
@@ -22,6 +22,7 @@ type Model struct {
 	CreatedOn      time.Time           `json:"CreatedOn" bson:"CreatedOn,omitempty"`
 	UpdatedOn      time.Time           `json:"UpdatedOn" bson:"UpdatedOn,omitempty"`
 	Version        int                 `json:"Version" bson:"Version,omitempty"`
+	SchemaVersion  int                 `json:"SchemaVersion" bson:"SchemaVersion,omitempty"`
 }
 
 // Creates a new model
@@ -85,30 +86,40 @@ func (m *Model) GetCollectionName() string {
 	return m.CollectionName
 }
 
+// Returns the id of the model
+func (m *Model) GetId() string {
+	return m.Id
+}
+
 // A base method to be used by models to saves the model to the database
 func (m *Model) SaveModel(obj any, ctx context.Context) (*Result, error) {
-	collection, err := m.Collection().MongoCollection(ctx)
+	backend, err := m.Collection().Backend(ctx)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("failed to get collection to save model to: %v", err)
+		return EmptyResult(), fmt.Errorf("failed to get collection to save model to: %w", err)
 	}
 	if m.Id == "" {
-		m.Id = Uuid()
+		m.Id = m.Collection().NewID(ctx)
 	}
 	m.ID = m.Id
 	filter := bson.M{"Id": m.Id}
 	// Here we convert the object to a bson map so we can make adjustments
 	// We need to remove the _id field so it doesnt clash with the setOnInsert
-	// We also make sure the Id field is set with the UUID we generated
+	// We also make sure the Id field is set with the id we generated
 	bsonMap := bson.M{}
 	bsonBytes, err := bson.Marshal(obj)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("failed to marshal model to bson: %v", err)
+		return EmptyResult(), fmt.Errorf("failed to marshal model to bson: %w", err)
 	}
 	bson.Unmarshal(bsonBytes, &bsonMap)
 	delete(bsonMap, "CreatedOn")
 	delete(bsonMap, "Version")
 	delete(bsonMap, "_id")
 	bsonMap["Id"] = m.Id
+	// Stamp the document with the current schema version so it isn't upgraded when read
+	if schemaVersion := configFor(m.CollectionName).currentSchemaVersion(); schemaVersion > 0 {
+		m.SchemaVersion = schemaVersion
+		bsonMap["SchemaVersion"] = schemaVersion
+	}
 	// bsonMap["UpdatedOn"] = Now(ctx)
 	// fmt.Println("bsonMap: ", bsonMap)
 	update := bson.M{
@@ -121,9 +132,9 @@ func (m *Model) SaveModel(obj any, ctx context.Context) (*Result, error) {
 	}
 	// fmt.Println("Update: ", update)
 	opts := options.UpdateOne().SetUpsert(true)
-	res, err := collection.UpdateOne(ctx, filter, update, opts)
+	res, err := backend.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("error saving model: %v", err)
+		return EmptyResult(), fmt.Errorf("error saving model: %w", err)
 	}
 	// fmt.Println("Saved: Matched:", res.MatchedCount, " Modified: ", res.ModifiedCount, " Upserted: ", res.UpsertedCount, " UpsertedID: ", res.UpsertedID)
 	return ResultFromUpdate(res), nil
@@ -131,17 +142,17 @@ func (m *Model) SaveModel(obj any, ctx context.Context) (*Result, error) {
 
 // Deletes the object from the database
 func (m *Model) Delete(ctx context.Context) (*Result, error) {
-	collection, err := m.Collection().MongoCollection(ctx)
+	backend, err := m.Collection().Backend(ctx)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("failed to get collection to delete model from: %v", err)
+		return EmptyResult(), fmt.Errorf("failed to get collection to delete model from: %w", err)
 	}
 	if m.Id == "" {
 		return EmptyResult(), fmt.Errorf("cannot delete model with no id")
 	}
 	filter := bson.M{"Id": m.Id}
-	res, err := collection.DeleteOne(ctx, filter)
+	res, err := backend.DeleteOne(ctx, filter)
 	if err != nil {
-		return EmptyResult(), fmt.Errorf("error deleting model: %v", err)
+		return EmptyResult(), fmt.Errorf("error deleting model: %w", err)
 	}
 	return ResultFromDelete(res), nil
 }
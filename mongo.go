@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -17,41 +19,76 @@ const DbNameKey Key = "dbName"
 const NowKey Key = "now"
 const MockDbErrorKey Key = "mockDbError"
 
-// var client *mongo.Client
+// The client shared by every database and the databases connected so far, guarded by dbsMu
+var dbsMu sync.Mutex
+var client *mongo.Client
 var dbs = make(map[string]*mongo.Database)
 
 // Connect to the MongoDB database
 // If a database name is provided, it will connect to that database
 // If no database name is provided, it will use the MONGO_DB environment variable
 // If the database is already connected, it will return the existing connection
+// Every database shares one client, which is connected to MONGO_URI the first time
 // If the connection fails, it will return an error
 func Connect(db ...string) (*mongo.Database, error) {
-	// fmt.Println("Connect db")
-	uri := os.Getenv("MONGO_URI")
-	env := os.Getenv("ENV")
-
 	var dbName string
 	if len(db) > 0 {
 		dbName = db[0]
 	} else {
 		dbName = os.Getenv("MONGO_DB")
 	}
-	if dbs[dbName] == nil {
-		if env != "test" {
-			log.Printf("connecting to db: %s:%s\n", uri, dbName)
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	if dbs[dbName] != nil {
+		return dbs[dbName], nil
+	}
+	if client == nil {
+		uri := os.Getenv("MONGO_URI")
+		level := slog.LevelInfo
+		if os.Getenv("ENV") == "test" {
+			level = slog.LevelDebug
 		}
-		mc, err := mongo.Connect(options.Client().ApplyURI(uri))
+		Logger().Log(context.Background(), level, "connecting to db", "uri", redactUri(uri), "db", dbName)
+		endSpan := traceConnect(dbName)
+		opts := options.Client().ApplyURI(uri).SetMonitor(newCommandMonitor()).SetPoolMonitor(newPoolMonitor())
+		mc, err := mongo.Connect(opts)
+		endSpan(err)
 		if err != nil {
-			return nil, fmt.Errorf("error connecting to db: %v", err)
+			Logger().Error("error connecting to db", "uri", redactUri(uri), "db", dbName, "error", err)
+			return nil, fmt.Errorf("error connecting to db: %w", err)
 		}
-		// client = mc
-		dbs[dbName] = mc.Database(dbName)
+		client = mc
 	}
+	dbs[dbName] = client.Database(dbName)
 	return dbs[dbName], nil
 }
 
+// Disconnects the shared client and forgets every database, the next call to Connect or Db connects again
+func Disconnect(ctx context.Context) error {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	if client == nil {
+		return nil
+	}
+	err := client.Disconnect(ctx)
+	client = nil
+	clear(dbs)
+	if err != nil {
+		return fmt.Errorf("error disconnecting from db: %w", err)
+	}
+	return nil
+}
+
+// Forgets the database so the next call to Connect or Db gets it again
+func forgetDb(dbName string) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	delete(dbs, dbName)
+}
+
 // Get the database connection
 // If the database name is not in the context, it will return an error
+// If the database has an open circuit breaker, it will return ErrCircuitOpen
 // If the database is not connected, it will connect to the database
 // If the connection fails, it will return an error
 // If the connection is successful, it will return the database connection
@@ -65,8 +102,41 @@ func Db(ctx context.Context) (*mongo.Database, error) {
 	if ok {
 		return nil, errors.New(mockError)
 	}
-	if dbs[dbName] == nil {
-		return Connect(dbName)
+	if breaker := CircuitBreakerFor(dbName); breaker != nil && breaker.State() == CircuitOpen {
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, dbName)
 	}
-	return dbs[dbName], nil
+	return Connect(dbName)
+}
+
+// Drops the database in the context, or empties it if it is an in-memory database
+// To prevent accidents this only works on databases whose names start with "test"
+func DropDatabase(ctx context.Context) error {
+	if err := requireTestDb(ctx); err != nil {
+		return err
+	}
+	if memory := memoryDbFrom(ctx); memory != nil {
+		memory.Reset()
+		return nil
+	}
+	db, err := Db(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database to drop: %w", err)
+	}
+	if err := db.Drop(ctx); err != nil {
+		return fmt.Errorf("error dropping database: %w", err)
+	}
+	forgetDb(db.Name())
+	return nil
+}
+
+// Returns an error unless the database name in the context starts with "test"
+func requireTestDb(ctx context.Context) error {
+	dbName, ok := ctx.Value(DbNameKey).(string)
+	if !ok {
+		return fmt.Errorf("%s not found in context", DbNameKey)
+	}
+	if !strings.HasPrefix(dbName, "test") {
+		return ErrClearCanOnlyBeUsedOnDbsStartingWithTest
+	}
+	return nil
 }
@@ -1,12 +1,16 @@
 package bark_test
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/jaredtmartin/bark-go-mongo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func TestConnect(t *testing.T) {
@@ -32,6 +36,43 @@ func TestConnect(t *testing.T) {
 		assert.Equal(t, dbName, db.Name())
 	})
 
+	// Test case: Every database shares one client, even when connecting concurrently
+	t.Run("Shares one client", func(t *testing.T) {
+		var wg sync.WaitGroup
+		connected := make([]*mongo.Database, 10)
+		for i := range connected {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				connected[i], _ = bark.Connect(fmt.Sprintf("shareddb%d", i%2))
+			}()
+		}
+		wg.Wait()
+		for _, db := range connected {
+			require.NotNil(t, db)
+			assert.Same(t, connected[0].Client(), db.Client())
+		}
+	})
+
+	// Test case: A collection uses the database in each context
+	t.Run("Collections follow the context's database", func(t *testing.T) {
+		dogs := bark.NewCollection[*Dog](DogCollectionName)
+		for _, dbName := range []string{"firstdb", "seconddb"} {
+			collection, err := dogs.MongoCollection(context.WithValue(context.Background(), bark.DbNameKey, dbName))
+			require.NoError(t, err)
+			assert.Equal(t, dbName, collection.Database().Name())
+		}
+	})
+
+	// Test case: Disconnecting closes the shared client and the next connect opens a new one
+	t.Run("Disconnect", func(t *testing.T) {
+		before, err := bark.Connect()
+		require.NoError(t, err)
+		require.NoError(t, bark.Disconnect(context.Background()))
+		after, err := bark.Connect()
+		require.NoError(t, err)
+		assert.NotSame(t, before.Client(), after.Client())
+	})
 }
 
 // func TestInvalidUri(t *testing.T) {
@@ -2,20 +2,108 @@ package bark
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 )
 
-// Returns the current time in RFC3339 format
-// Returns time set in the context if it is set
+var ErrInvalidNow = errors.New("invalid time set in context")
+
+// Tells the time, carried in the context under NowKey so tests can control it
+type Clock interface {
+	Now() time.Time
+}
+
+// Returns a context whose clock is used by Now
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, NowKey, clock)
+}
+
+// Returns the current time
+// Returns the time from the clock, time.Time or RFC3339 string set in the context if it is set
 // Otherwise, returns the current time
+// A malformed value is logged and the current time is returned, use NowErr to handle it instead
 func Now(ctx context.Context) time.Time {
-	nowStr, ok := ctx.Value(NowKey).(string)
-	if !ok {
-		return time.Now()
-	}
-	now, err := time.Parse(time.RFC3339, nowStr)
+	now, err := NowErr(ctx)
 	if err != nil {
+		Logger().WarnContext(ctx, "using the current time", "error", err)
 		return time.Now()
 	}
 	return now
 }
+
+// Returns the current time like Now, but returns an error if the value set in the context is malformed
+func NowErr(ctx context.Context) (time.Time, error) {
+	switch value := ctx.Value(NowKey).(type) {
+	case nil:
+		return time.Now(), nil
+	case Clock:
+		return value.Now(), nil
+	case time.Time:
+		return value, nil
+	case string:
+		now, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %w", ErrInvalidNow, err)
+		}
+		return now, nil
+	default:
+		return time.Time{}, fmt.Errorf("%w: unexpected %T", ErrInvalidNow, value)
+	}
+}
+
+// Returns the clock that tells the real time
+func RealClock() Clock {
+	return ClockFunc(time.Now)
+}
+
+// Returns a clock that is frozen at the given time
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// Returns a clock that runs in real time, shifted by the offset
+func OffsetClock(offset time.Duration) Clock {
+	return ClockFunc(func() time.Time { return time.Now().Add(offset) })
+}
+
+// Adapts a function to the Clock interface
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// A clock that only moves when it is told to, safe to share between goroutines
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Creates a manual clock starting at the given time
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Returns the clock's current time
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Moves the clock forward by the duration and returns the new time
+func (c *ManualClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Sets the clock to the given time
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
@@ -2,7 +2,9 @@ package bark_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/jaredtmartin/bark-go-mongo"
 )
@@ -24,3 +26,50 @@ func TestNowMode(t *testing.T) {
 		t.Errorf("Expected Now() to return %s, got %s", expected, result)
 	}
 }
+func TestClocks(t *testing.T) {
+	start := time.Date(2024, 3, 27, 19, 55, 38, 0, time.UTC)
+	ctx := context.Background()
+
+	t.Run("Fixed clock is frozen", func(t *testing.T) {
+		clockCtx := bark.WithClock(ctx, bark.FixedClock(start))
+		if now := bark.Now(clockCtx); !now.Equal(start) {
+			t.Errorf("Expected %v, got %v", start, now)
+		}
+	})
+	t.Run("Offset clock is shifted from the real time", func(t *testing.T) {
+		clockCtx := bark.WithClock(ctx, bark.OffsetClock(-24*time.Hour))
+		diff := time.Since(bark.Now(clockCtx))
+		if diff < 24*time.Hour || diff > 24*time.Hour+time.Minute {
+			t.Errorf("Expected the clock to be a day behind, got %v", diff)
+		}
+	})
+	t.Run("Manual clock advances when told", func(t *testing.T) {
+		clock := bark.NewManualClock(start)
+		clockCtx := bark.WithClock(ctx, clock)
+		clock.Advance(time.Hour)
+		if now := bark.Now(clockCtx); !now.Equal(start.Add(time.Hour)) {
+			t.Errorf("Expected an hour later, got %v", now)
+		}
+		clock.Set(start)
+		if now := bark.Now(clockCtx); !now.Equal(start) {
+			t.Errorf("Expected %v after Set, got %v", start, now)
+		}
+	})
+	t.Run("Accepts time values", func(t *testing.T) {
+		timeCtx := context.WithValue(ctx, bark.NowKey, start)
+		if now := bark.Now(timeCtx); !now.Equal(start) {
+			t.Errorf("Expected %v, got %v", start, now)
+		}
+	})
+	t.Run("Reports malformed values", func(t *testing.T) {
+		for _, value := range []any{"yesterday", 42} {
+			badCtx := context.WithValue(ctx, bark.NowKey, value)
+			if _, err := bark.NowErr(badCtx); !errors.Is(err, bark.ErrInvalidNow) {
+				t.Errorf("Expected ErrInvalidNow for %v, got %v", value, err)
+			}
+			if time.Since(bark.Now(badCtx)) > time.Minute {
+				t.Errorf("Expected Now to fall back to the current time for %v", value)
+			}
+		}
+	})
+}
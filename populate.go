@@ -0,0 +1,502 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const PopulateKey Key = "populate"
+
+// The fields to populate and how
+type populateOptions struct {
+	fields []string
+	lookup bool
+}
+
+// Returns a context whose Find, FindOne and Get calls populate the named reference fields
+// Each field is loaded with one follow-up $in query for all the documents found
+func WithPopulate(ctx context.Context, fields ...string) context.Context {
+	return context.WithValue(ctx, PopulateKey, &populateOptions{fields: fields})
+}
+
+// Like WithPopulate, but Find joins the referenced documents in with $lookup so it takes a single aggregation
+// FindOne and Get still use follow-up queries
+func WithPopulateLookup(ctx context.Context, fields ...string) context.Context {
+	return context.WithValue(ctx, PopulateKey, &populateOptions{fields: fields, lookup: true})
+}
+
+// Returns the populate options in the context, or nil if there aren't any
+func populateFrom(ctx context.Context) *populateOptions {
+	opts, _ := ctx.Value(PopulateKey).(*populateOptions)
+	if opts == nil || len(opts.fields) == 0 {
+		return nil
+	}
+	return opts
+}
+
+// A field that holds documents referenced from another collection
+//
+// References are declared with a bark tag naming the referenced collection.
+// On a string or []string field of ids, the tag fills the field named by into,
+// which defaults to the id field's name without its Id or Ids suffix, pluralized for Ids:
+//
+//	OwnerId string   `bark:"ref=owners"`      // fills Owner
+//	Owner   *Owner   `bson:"-"`
+//	ToyIds  []string `bark:"ref=toys"`        // fills Toys
+//	Toys    []*Toy   `bson:"-"`
+//
+// On a model field, foreign names the key in the referenced collection holding this document's Id,
+// which is how one-to-many and reverse many-to-many references are declared:
+//
+//	Dogs []*Dog `bson:"-" bark:"ref=dogs,foreign=OwnerId"`
+type reference struct {
+	// The Go field that is filled in
+	field []int
+	name  string
+	// The Go field holding the ids, nil when the referenced documents hold this document's Id
+	local []int
+	// The bson key of the ids, or Id for foreign references
+	localKey   string
+	collection string
+	// The key in the referenced collection matched against the ids, Id unless the reference is foreign
+	foreignKey string
+	many       bool
+	elem       reflect.Type
+}
+
+var referencesCache sync.Map
+
+// Returns the references declared on the model type by field name
+func referencesOf(t reflect.Type) (map[string]*reference, error) {
+	if cached, ok := referencesCache.Load(t); ok {
+		return cached.(map[string]*reference), nil
+	}
+	structType := t
+	for structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	refs := make(map[string]*reference)
+	if structType.Kind() != reflect.Struct {
+		return refs, nil
+	}
+	for _, field := range reflect.VisibleFields(structType) {
+		tag, ok := field.Tag.Lookup("bark")
+		if !ok || field.Anonymous {
+			continue
+		}
+		settings := parseTag(tag)
+		collection := settings["ref"]
+		if collection == "" {
+			continue
+		}
+		ref := &reference{collection: collection, foreignKey: "Id"}
+		if foreign := settings["foreign"]; foreign != "" {
+			ref.field, ref.name = field.Index, field.Name
+			ref.localKey = "Id"
+			ref.foreignKey = foreign
+			ref.many = field.Type.Kind() == reflect.Slice
+			ref.elem = field.Type
+		} else {
+			switch {
+			case field.Type.Kind() == reflect.String:
+				ref.name = strings.TrimSuffix(field.Name, "Id")
+			case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+				ref.name = strings.TrimSuffix(field.Name, "Ids") + "s"
+				ref.many = true
+			default:
+				return nil, fmt.Errorf("reference %s on %s must be a string or []string of ids", field.Name, t)
+			}
+			if into := settings["into"]; into != "" {
+				ref.name = into
+			}
+			target, ok := structType.FieldByName(ref.name)
+			if !ok {
+				return nil, fmt.Errorf("reference %s on %s has no field %s to fill", field.Name, t, ref.name)
+			}
+			if (target.Type.Kind() == reflect.Slice) != ref.many {
+				return nil, fmt.Errorf("field %s on %s must be a slice if and only if %s is", ref.name, t, field.Name)
+			}
+			ref.field = target.Index
+			ref.local = field.Index
+			ref.localKey = bsonKey(field)
+			ref.elem = target.Type
+		}
+		if ref.many {
+			ref.elem = ref.elem.Elem()
+		}
+		refs[ref.name] = ref
+	}
+	referencesCache.Store(t, refs)
+	return refs, nil
+}
+
+// Splits a tag like "ref=owners,into=Owner" into its settings
+func parseTag(tag string) map[string]string {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		settings[key] = value
+	}
+	return settings
+}
+
+// Returns the key a struct field is stored under, following the driver's rules
+func bsonKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("bson"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// A field with a setting in its bark tag
+type taggedField struct {
+	// The dotted bson path of the field
+	key   string
+	value string
+	field reflect.StructField
+}
+
+// Returns the fields whose bark tag has the setting, following inlined and nested structs
+func taggedFields(t reflect.Type, setting string) []taggedField {
+	var fields []taggedField
+	collectTaggedFields(t, setting, "", &fields)
+	return fields
+}
+
+func collectTaggedFields(t reflect.Type, setting string, prefix string, fields *[]taggedField) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("bson")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		_, bsonOpts, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+bsonOpts+",", ",inline,") {
+			collectTaggedFields(field.Type, setting, prefix, fields)
+			continue
+		}
+		key := prefix + bsonKey(field)
+		if value, ok := parseTag(field.Tag.Get("bark"))[setting]; ok {
+			*fields = append(*fields, taggedField{key: key, value: value, field: field})
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() != "time" {
+			collectTaggedFields(field.Type, setting, key+".", fields)
+		}
+	}
+}
+
+// Returns the references for the fields, in order
+func (c *Collection[T]) references(fields []string) ([]*reference, error) {
+	refs, err := referencesOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]*reference, len(fields))
+	for i, field := range fields {
+		ref, ok := refs[field]
+		if !ok {
+			return nil, fmt.Errorf("%s has no reference %s", reflect.TypeFor[T](), field)
+		}
+		selected[i] = ref
+	}
+	return selected, nil
+}
+
+// Fills in the reference fields of the objects, with one query per field
+func (c *Collection[T]) Populate(objs []T, fields []string, ctx context.Context) error {
+	refs, err := c.references(fields)
+	if err != nil {
+		return err
+	}
+	// Referenced documents aren't populated themselves
+	ctx = context.WithValue(ctx, PopulateKey, (*populateOptions)(nil))
+	for _, ref := range refs {
+		var keys []string
+		seen := make(map[string]bool)
+		for _, obj := range objs {
+			for _, key := range ref.keys(obj) {
+				if key != "" && !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		backend, err := NewCollection[*Model](ref.collection).Backend(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get collection to populate %s from: %w", ref.name, err)
+		}
+		cursor, err := backend.Find(ctx, bson.M{ref.foreignKey: bson.M{"$in": keys}}, nil)
+		if err != nil {
+			return fmt.Errorf("error populating %s: %w", ref.name, err)
+		}
+		docs, err := ref.decodeAll(backend, cursor, ctx)
+		if err != nil {
+			return fmt.Errorf("error populating %s: %w", ref.name, err)
+		}
+		for _, obj := range objs {
+			ref.fill(obj, docs)
+		}
+	}
+	return nil
+}
+
+// Populates the objects with the fields in the context, if any
+func (c *Collection[T]) populate(objs []T, ctx context.Context) error {
+	opts := populateFrom(ctx)
+	if opts == nil || len(objs) == 0 {
+		return nil
+	}
+	return c.Populate(objs, opts.fields, ctx)
+}
+
+// Finds the documents matching the filter and joins in the referenced documents with $lookup
+func (c *Collection[T]) findWithLookup(filter bson.M, opts *options.FindOptionsBuilder, fields []string, ctx context.Context) ([]T, error) {
+	refs, err := c.references(fields)
+	if err != nil {
+		return nil, err
+	}
+	findOpts, err := resolveOptions[options.FindOptions](opts)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := bson.A{bson.D{{Key: "$match", Value: filter}}}
+	if findOpts.Sort != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: findOpts.Sort}})
+	}
+	if findOpts.Skip != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: *findOpts.Skip}})
+	}
+	if findOpts.Limit != nil && *findOpts.Limit != 0 {
+		limit := *findOpts.Limit
+		if limit < 0 {
+			limit = -limit
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	for _, ref := range refs {
+		pipeline = append(pipeline, bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: ref.collection},
+			{Key: "localField", Value: ref.localKey},
+			{Key: "foreignField", Value: ref.foreignKey},
+			{Key: "as", Value: lookupField(ref)},
+		}}})
+	}
+	// Projected after the lookups so they can still use the fields it leaves out
+	if findOpts.Projection != nil {
+		projection, err := projectLookups(findOpts.Projection, refs)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to find in: %w", err)
+	}
+	cursor, err := backend.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching documents: %w", err)
+	}
+	writeBack := backend
+	if findOpts.Projection != nil {
+		writeBack = nil
+	}
+	defer cursor.Close(ctx)
+	var results []T
+	for cursor.Next(ctx) {
+		raw, joined, err := splitDocument(cursor.Current(), func(key string) bool { return strings.HasPrefix(key, lookupPrefix) })
+		if err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		obj := *new(T)
+		if err := c.decode(writeBack, raw, &obj, ctx); err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		obj.SetCollectionName(c.Name)
+		for _, ref := range refs {
+			array, _ := joined[lookupField(ref)].(bson.A)
+			docs, err := ref.decodeJoined(array, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error populating %s: %w", ref.name, err)
+			}
+			ref.fill(obj, docs)
+		}
+		results = append(results, obj)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error decoding documents: %w", err)
+	}
+	return results, nil
+}
+
+const lookupPrefix = "_barkPopulate_"
+
+// Returns the projection with the fields $lookup adds, and the keys they are matched on, included
+// if it is an inclusion projection
+func projectLookups(projection any, refs []*reference) (bson.D, error) {
+	spec, err := toDocument(projection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection: %w", err)
+	}
+	include := false
+	for _, elem := range spec {
+		if _, isOperator := elem.Value.(bson.D); elem.Key != "_id" && (isOperator || truthy(elem.Value)) {
+			include = true
+		}
+	}
+	if !include {
+		return spec, nil
+	}
+	for _, ref := range refs {
+		if _, found := lookupKey(spec, ref.localKey); !found {
+			spec = append(spec, bson.E{Key: ref.localKey, Value: 1})
+		}
+		spec = append(spec, bson.E{Key: lookupField(ref), Value: 1})
+	}
+	return spec, nil
+}
+
+// Returns the field $lookup puts the referenced documents in
+func lookupField(ref *reference) string {
+	return lookupPrefix + ref.name
+}
+
+// A referenced document with its keys
+type referencedDoc struct {
+	keys  []string
+	value reflect.Value
+}
+
+// Returns the ids the object references, or its own Id for foreign references
+func (ref *reference) keys(obj any) []string {
+	if ref.local == nil {
+		return []string{modelId(obj)}
+	}
+	value := structOf(obj).FieldByIndex(ref.local)
+	if value.Kind() == reflect.String {
+		return []string{value.String()}
+	}
+	keys := make([]string, value.Len())
+	for i := range keys {
+		keys[i] = value.Index(i).String()
+	}
+	return keys
+}
+
+// Decodes the documents in the cursor into values of the referenced type
+func (ref *reference) decodeAll(backend Backend, cursor Cursor, ctx context.Context) ([]referencedDoc, error) {
+	defer cursor.Close(ctx)
+	var docs []referencedDoc
+	for cursor.Next(ctx) {
+		doc, err := ref.decode(backend, cursor.Current(), ctx)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, cursor.Err()
+}
+
+// Decodes the documents joined in by $lookup
+func (ref *reference) decodeJoined(array bson.A, ctx context.Context) ([]referencedDoc, error) {
+	if len(array) == 0 {
+		return nil, nil
+	}
+	// Upgrades are written back to the referenced collection
+	backend, err := NewCollection[*Model](ref.collection).Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to populate %s from: %w", ref.name, err)
+	}
+	docs := make([]referencedDoc, len(array))
+	for i, item := range array {
+		raw, err := bson.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		if docs[i], err = ref.decode(backend, raw, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// Decodes a referenced document, upgrading it like its collection would, and reads the keys it is matched on
+func (ref *reference) decode(backend Backend, raw bson.Raw, ctx context.Context) (referencedDoc, error) {
+	elem := ref.elem
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	ptr := reflect.New(elem)
+	raw, err := decodeUpgraded(ref.collection, backend, raw, ptr.Interface(), ctx)
+	if err != nil {
+		return referencedDoc{}, err
+	}
+	if model, ok := ptr.Interface().(ModelWithCollection); ok {
+		model.SetCollectionName(ref.collection)
+	}
+	value := ptr
+	if ref.elem.Kind() != reflect.Pointer {
+		value = ptr.Elem()
+	}
+	doc := referencedDoc{value: value}
+	var fields bson.D
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return referencedDoc{}, err
+	}
+	for _, key := range expandArrays(resolvePath(fields, ref.foreignKey)) {
+		if key, ok := key.(string); ok {
+			doc.keys = append(doc.keys, key)
+		}
+	}
+	return doc, nil
+}
+
+// Fills the reference field of the object from the referenced documents
+// Ids keep their order and missing documents are left out
+func (ref *reference) fill(obj any, docs []referencedDoc) {
+	byKey := make(map[string][]reflect.Value)
+	for _, doc := range docs {
+		for _, key := range doc.keys {
+			byKey[key] = append(byKey[key], doc.value)
+		}
+	}
+	var values []reflect.Value
+	for _, key := range ref.keys(obj) {
+		values = append(values, byKey[key]...)
+	}
+	field := structOf(obj).FieldByIndex(ref.field)
+	if !ref.many {
+		if len(values) > 0 {
+			field.Set(values[0])
+		}
+		return
+	}
+	slice := reflect.MakeSlice(field.Type(), 0, len(values))
+	field.Set(reflect.Append(slice, values...))
+}
+
+// Returns the struct a model points to
+func structOf(obj any) reflect.Value {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+package bark_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Owner struct {
+	bark.Model `bson:",inline"`
+	Name       string `bson:"Name"`
+	Pets       []*Pet `bson:"-" bark:"ref=pets,foreign=OwnerId"`
+}
+
+type Toy struct {
+	bark.Model `bson:",inline"`
+	Name       string `bson:"Name"`
+}
+
+type Pet struct {
+	bark.Model `bson:",inline"`
+	Name       string   `bson:"Name"`
+	OwnerId    string   `bson:"OwnerId" bark:"ref=owners"`
+	Owner      *Owner   `bson:"-"`
+	ToyIds     []string `bson:"ToyIds" bark:"ref=toys"`
+	Toys       []*Toy   `bson:"-"`
+}
+
+type Vet struct {
+	bark.Model `bson:",inline"`
+	Name       string `bson:"Name"`
+}
+
+type Patient struct {
+	bark.Model `bson:",inline"`
+	VetId      string `bson:"VetId" bark:"ref=upgraded_vets"`
+	Vet        *Vet   `bson:"-"`
+}
+
+// Inserts the documents into the named collection
+func insertAll(name string, ctx context.Context, t *testing.T, docs ...bson.M) {
+	backend, err := bark.NewCollection[*Pet](name).Backend(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get backend: %v", err)
+	}
+	for _, doc := range docs {
+		if _, err := backend.InsertOne(ctx, doc); err != nil {
+			t.Fatalf("Failed to insert %v: %v", doc, err)
+		}
+	}
+}
+
+func TestPopulate(t *testing.T) {
+	ctx := setupMemoryTest("Populate", "2024-03-27T19:55:38.782Z", t)
+	insertAll("owners", ctx, t,
+		bson.M{"_id": "o1", "Id": "o1", "Name": "Alice"},
+		bson.M{"_id": "o2", "Id": "o2", "Name": "Bob"})
+	insertAll("toys", ctx, t,
+		bson.M{"_id": "t1", "Id": "t1", "Name": "Ball"},
+		bson.M{"_id": "t2", "Id": "t2", "Name": "Bone"})
+	insertAll("pets", ctx, t,
+		bson.M{"_id": "p1", "Id": "p1", "Name": "Fido", "OwnerId": "o1", "ToyIds": bson.A{"t2", "t9", "t1"}},
+		bson.M{"_id": "p2", "Id": "p2", "Name": "Spot", "OwnerId": "o1"},
+		bson.M{"_id": "p3", "Id": "p3", "Name": "Rex", "OwnerId": "o9"})
+	pets := bark.NewCollection[*Pet]("pets")
+	owners := bark.NewCollection[*Owner]("owners")
+	sorted := options.Find().SetSort(bson.M{"Name": 1})
+
+	for name, populate := range map[string]func(context.Context, ...string) context.Context{
+		"With follow-up queries": bark.WithPopulate,
+		"With $lookup":           bark.WithPopulateLookup,
+	} {
+		t.Run(name, func(t *testing.T) {
+			faults := bark.NewFaults()
+			results, err := pets.Find(bson.M{}, sorted, populate(bark.WithFaults(ctx, faults), "Owner", "Toys"))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("Expected 3 pets, got %d", len(results))
+			}
+			fido, rex, spot := results[0], results[1], results[2]
+			if fido.Owner == nil || fido.Owner.Name != "Alice" || spot.Owner == nil || spot.Owner.Name != "Alice" {
+				t.Errorf("Expected Fido and Spot to belong to Alice, got %v and %v", fido.Owner, spot.Owner)
+			}
+			if rex.Owner != nil {
+				t.Errorf("Expected Rex's missing owner to stay nil, got %v", rex.Owner)
+			}
+			if len(fido.Toys) != 2 || fido.Toys[0].Name != "Bone" || fido.Toys[1].Name != "Ball" {
+				t.Errorf("Expected Fido's toys in id order, got %v", fido.Toys)
+			}
+			if fido.Toys[0].GetCollectionName() != "toys" {
+				t.Errorf("Expected toys to know their collection, got %q", fido.Toys[0].GetCollectionName())
+			}
+			if calls := faults.Calls("", ""); calls > 3 {
+				t.Errorf("Expected at most one query per field, got %d", calls)
+			}
+		})
+	}
+	t.Run("Projects after the lookups", func(t *testing.T) {
+		projected := options.Find().SetSort(bson.M{"Name": 1}).SetProjection(bson.M{"Name": 1})
+		results, err := pets.Find(bson.M{"Name": "Fido"}, projected, bark.WithPopulateLookup(ctx, "Owner", "Toys"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 1 || results[0].Owner == nil || results[0].Owner.Name != "Alice" || len(results[0].Toys) != 2 {
+			t.Errorf("Expected Fido with Alice and 2 toys, got %+v", results)
+		}
+	})
+	t.Run("Populates one-to-many references on FindOne", func(t *testing.T) {
+		alice, err := owners.Get("o1", bark.WithPopulate(ctx, "Pets"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(alice.Pets) != 2 || alice.Pets[0].Name != "Fido" || alice.Pets[1].Name != "Spot" {
+			t.Errorf("Expected Alice's pets, got %v", alice.Pets)
+		}
+		if alice.Pets[0].Owner != nil {
+			t.Error("Expected referenced documents not to be populated themselves")
+		}
+	})
+	t.Run("Populates loaded objects", func(t *testing.T) {
+		bob, err := owners.Get("o2", ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := owners.Populate([]*Owner{bob}, []string{"Pets"}, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if bob.Pets == nil || len(bob.Pets) != 0 {
+			t.Errorf("Expected Bob to have no pets, got %v", bob.Pets)
+		}
+	})
+	t.Run("Rejects unknown references", func(t *testing.T) {
+		if _, err := pets.Find(bson.M{}, nil, bark.WithPopulate(ctx, "Vet")); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+func TestPopulateUpgrades(t *testing.T) {
+	ctx := setupMemoryTest("PopulateUpgrades", "2024-03-27T19:55:38.782Z", t)
+	bark.NewCollection[*Vet]("upgraded_vets").RegisterUpgrade(0, func(doc bson.M) (bson.M, error) {
+		doc["Name"] = doc["Title"]
+		delete(doc, "Title")
+		return doc, nil
+	})
+	insertAll("upgraded_vets", ctx, t, bson.M{"_id": "v1", "Id": "v1", "Title": "Dr. Jones"})
+	insertAll("patients", ctx, t, bson.M{"_id": "p1", "Id": "p1", "VetId": "v1"})
+	patients := bark.NewCollection[*Patient]("patients")
+
+	for name, populate := range map[string]func(context.Context, ...string) context.Context{
+		"With follow-up queries": bark.WithPopulate,
+		"With $lookup":           bark.WithPopulateLookup,
+	} {
+		t.Run(name, func(t *testing.T) {
+			patient, err := patients.Get("p1", populate(ctx, "Vet"))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if patient.Vet == nil || patient.Vet.Name != "Dr. Jones" {
+				t.Errorf("Expected the vet to be upgraded, got %+v", patient.Vet)
+			}
+		})
+	}
+}
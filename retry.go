@@ -0,0 +1,140 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// How to retry operations that fail with a retryable error
+type RetryPolicy struct {
+	// Total number of tries including the first, 1 or less turns retries off
+	MaxAttempts int
+	// Wait before the first retry
+	InitialBackoff time.Duration
+	// Longest wait between retries, 0 for no limit
+	MaxBackoff time.Duration
+	// How much the wait grows after each retry, values below 1 are treated as 2
+	Multiplier float64
+	// Fraction of each wait that is randomized, from 0 for none to 1 for full jitter
+	Jitter float64
+	// Error labels that make an error retryable, nil for DefaultRetryableLabels
+	// Network errors are retryable for reads, writes need a label since they may have been applied
+	// before the connection failed
+	Labels []string
+}
+
+// The error labels retried when a policy doesn't list its own
+var DefaultRetryableLabels = []string{"RetryableWriteError", transientTransactionError}
+
+// Returns a policy with exponential backoff and full jitter
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         1,
+	}
+}
+
+var retryPolicyMu sync.RWMutex
+var defaultRetryPolicy *RetryPolicy
+
+// Sets the policy used by collections that don't set their own, nil turns retries off
+func SetDefaultRetryPolicy(policy *RetryPolicy) {
+	retryPolicyMu.Lock()
+	defer retryPolicyMu.Unlock()
+	defaultRetryPolicy = policy
+}
+
+// Sets the retry policy for operations on the collection, nil uses the default policy
+func (c *Collection[T]) SetRetryPolicy(policy *RetryPolicy) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.retryPolicy = policy
+	return c
+}
+
+// Returns the collection's retry policy, or the default one
+func (cfg *collectionConfig) effectiveRetryPolicy() *RetryPolicy {
+	cfg.mu.RLock()
+	policy := cfg.retryPolicy
+	cfg.mu.RUnlock()
+	if policy != nil {
+		return policy
+	}
+	retryPolicyMu.RLock()
+	defer retryPolicyMu.RUnlock()
+	return defaultRetryPolicy
+}
+
+// Returns true if the operation's error is worth retrying under the policy
+func (p *RetryPolicy) retryable(op *Operation, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if mongo.IsNetworkError(err) && classOf(op.Name) == ReadOperation {
+		return true
+	}
+	labels := p.Labels
+	if labels == nil {
+		labels = DefaultRetryableLabels
+	}
+	for _, label := range labels {
+		if hasErrorLabel(err, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns how long to wait before the given retry, counting from 1
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	return time.Duration(wait * (1 - jitter*rand.Float64()))
+}
+
+// Retries the operation while it fails with a retryable error
+// Operations in a transaction aren't retried on their own, WithTransaction retries the whole transaction
+func (p *RetryPolicy) intercept(ctx context.Context, op *Operation, next func(ctx context.Context) error) error {
+	if InTransaction(ctx) {
+		return next(ctx)
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = next(ctx)
+		if attempt >= p.MaxAttempts || !p.retryable(op, err) {
+			return err
+		}
+		if p.wait(attempt, ctx) != nil {
+			return err
+		}
+	}
+}
+
+// Waits the backoff before the next attempt, returning early with the context's error if it is done
+func (p *RetryPolicy) wait(attempt int, ctx context.Context) error {
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
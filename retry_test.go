@@ -0,0 +1,138 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	ctx := setupMemoryTest("RetryPolicy", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	policy := &bark.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	dogs.SetRetryPolicy(policy)
+	defer dogs.SetRetryPolicy(nil)
+
+	t.Run("Retries transient errors", func(t *testing.T) {
+		faults := bark.NewFaults(bark.Fault{Operation: "UpdateOne", Times: 2, Err: bark.TransientError()})
+		faultCtx := bark.WithFaults(ctx, faults)
+		if _, err := NewDog("Spot").Save(faultCtx); err != nil {
+			t.Fatalf("Expected the save to succeed on the 3rd attempt, got %v", err)
+		}
+		if calls := faults.Calls(DogCollectionName, "UpdateOne"); calls != 3 {
+			t.Errorf("Expected 3 attempts, got %d", calls)
+		}
+	})
+	t.Run("Gives up after MaxAttempts", func(t *testing.T) {
+		faults := bark.NewFaults(bark.Fault{Operation: "CountDocuments", Err: bark.TransientError()})
+		_, err := dogs.Count(bson.M{}, bark.WithFaults(ctx, faults))
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+		if calls := faults.Calls(DogCollectionName, "CountDocuments"); calls != 3 {
+			t.Errorf("Expected 3 attempts, got %d", calls)
+		}
+	})
+	t.Run("Doesn't retry other errors", func(t *testing.T) {
+		faults := bark.NewFaults(bark.Fault{Operation: "UpdateOne", Err: bark.DuplicateKeyError()})
+		NewDog("Rex").Save(bark.WithFaults(ctx, faults))
+		if calls := faults.Calls(DogCollectionName, "UpdateOne"); calls != 1 {
+			t.Errorf("Expected 1 attempt, got %d", calls)
+		}
+	})
+	t.Run("Retries network errors on reads only", func(t *testing.T) {
+		faults := bark.NewFaults(
+			bark.Fault{Operation: "CountDocuments", Times: 1, Err: bark.NetworkError()},
+			bark.Fault{Operation: "UpdateOne", Err: bark.NetworkError()})
+		faultCtx := bark.WithFaults(ctx, faults)
+		if _, err := dogs.Count(bson.M{}, faultCtx); err != nil {
+			t.Errorf("Expected the count to succeed on the 2nd attempt, got %v", err)
+		}
+		if calls := faults.Calls(DogCollectionName, "CountDocuments"); calls != 2 {
+			t.Errorf("Expected 2 attempts, got %d", calls)
+		}
+		if _, err := NewDog("Max").Save(faultCtx); err == nil {
+			t.Error("Expected the save to fail")
+		}
+		if calls := faults.Calls(DogCollectionName, "UpdateOne"); calls != 1 {
+			t.Errorf("Expected a write that may have been applied not to be retried, got %d attempts", calls)
+		}
+	})
+	t.Run("Leaves transactions to WithTransaction", func(t *testing.T) {
+		faults := bark.NewFaults(bark.Fault{Operation: "CountDocuments", Err: bark.TransientError()})
+		bark.WithTransaction(bark.WithFaults(ctx, faults), func(txCtx context.Context) error {
+			_, err := dogs.Count(bson.M{}, txCtx)
+			return err
+		})
+		if calls := faults.Calls(DogCollectionName, "CountDocuments"); calls != 1 {
+			t.Errorf("Expected 1 attempt inside the transaction, got %d", calls)
+		}
+	})
+	t.Run("Other collections use the default policy", func(t *testing.T) {
+		faults := bark.NewFaults(bark.Fault{Operation: "CountDocuments", Err: errors.New("offline")})
+		bark.NewCollection[*Dog]("cats").Count(bson.M{}, bark.WithFaults(ctx, faults))
+		if calls := faults.Calls("cats", "CountDocuments"); calls != 1 {
+			t.Errorf("Expected no retries without a policy, got %d calls", calls)
+		}
+	})
+}
+func TestTimeouts(t *testing.T) {
+	ctx := setupMemoryTest("Timeouts", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	bark.SetDefaultTimeouts(bark.Timeouts{Read: time.Second, Write: time.Second})
+	defer bark.SetDefaultTimeouts(bark.Timeouts{})
+	dogs.SetTimeouts(bark.Timeouts{Read: 5 * time.Millisecond})
+	defer dogs.SetTimeouts(bark.Timeouts{})
+	slow := bark.NewFaults(bark.Fault{Delay: 50 * time.Millisecond})
+
+	t.Run("Reads use the collection's timeout", func(t *testing.T) {
+		_, err := dogs.Get("1111", bark.WithFaults(ctx, slow))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the read to time out, got %v", err)
+		}
+	})
+	t.Run("Writes fall back to the default timeout", func(t *testing.T) {
+		if _, err := NewDog("Spot").Save(bark.WithFaults(ctx, slow)); err != nil {
+			t.Errorf("Expected the write to finish within the default timeout, got %v", err)
+		}
+	})
+	t.Run("Deadlines in the context win", func(t *testing.T) {
+		deadlineCtx, cancel := context.WithTimeout(bark.WithFaults(ctx, slow), time.Second)
+		defer cancel()
+		if _, err := dogs.Get("1111", deadlineCtx); err != nil {
+			t.Errorf("Expected the context's deadline to be used, got %v", err)
+		}
+	})
+	t.Run("Find's deadline lasts until its cursor is read", func(t *testing.T) {
+		results, err := dogs.Find(bson.M{"Name": "Fido"}, nil, ctx)
+		if err != nil || len(results) != 1 {
+			t.Errorf("Expected 1 dog, got %d and %v", len(results), err)
+		}
+		activities := bark.NewCollection[*Activity]("timed_activities").SetTimeouts(bark.Timeouts{Read: 20 * time.Millisecond})
+		activities.InsertMany([]*Activity{activity("a1", "login"), activity("a2", "post")}, ctx)
+		faults := bark.NewFaults(bark.Fault{Operation: "Find", FailCursorAfter: 2, Err: errors.New("injected failure")})
+		backend, _ := activities.Backend(bark.WithFaults(ctx, faults))
+		cursor, err := backend.Find(ctx, bson.M{}, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer cursor.Close(ctx)
+		if !cursor.Next(ctx) {
+			t.Fatalf("Expected a document, got %v", cursor.Err())
+		}
+		time.Sleep(30 * time.Millisecond)
+		if cursor.Next(ctx) || !errors.Is(cursor.Err(), context.DeadlineExceeded) {
+			t.Errorf("Expected reading the cursor to stop at the deadline, got %v", cursor.Err())
+		}
+	})
+}
@@ -0,0 +1,363 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// How strictly a collection's schema is applied to writes
+type ValidationLevel string
+
+const (
+	// Every insert and update is validated
+	ValidationLevelStrict ValidationLevel = "strict"
+	// Inserts and updates to valid documents are validated, documents that were already invalid can still be updated
+	ValidationLevelModerate ValidationLevel = "moderate"
+	// Nothing is validated
+	ValidationLevelOff ValidationLevel = "off"
+)
+
+// What happens to a write that doesn't match a collection's schema
+type ValidationAction string
+
+const (
+	// The write is rejected
+	ValidationActionError ValidationAction = "error"
+	// The write goes ahead and the server logs a warning
+	ValidationActionWarn ValidationAction = "warn"
+)
+
+// Sets how EnsureSchema has the collection apply its schema, the default is strict with errors
+func (c *Collection[T]) SetValidation(level ValidationLevel, action ValidationAction) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.validationLevel = level
+	cfg.validationAction = action
+	return c
+}
+
+// Returns the collection's validation level and action with the defaults filled in
+func (cfg *collectionConfig) currentValidation() (ValidationLevel, ValidationAction) {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	level, action := cfg.validationLevel, cfg.validationAction
+	if level == "" {
+		level = ValidationLevelStrict
+	}
+	if action == "" {
+		action = ValidationActionError
+	}
+	return level, action
+}
+
+var schemasCache sync.Map
+
+// Returns the $jsonSchema for documents of the model type
+// Types come from the fields' Go types and keys from their bson tags, inlined structs are included field by field.
+// Fields tagged `bark:"required"` must be present and `bark:"enum=a|b|c"` limits a field, or the elements of a slice, to the values
+func SchemaFor[T any]() bson.D {
+	t := reflect.TypeFor[T]()
+	if cached, ok := schemasCache.Load(t); ok {
+		return cached.(bson.D)
+	}
+	schema := schemaOf(t, make(map[reflect.Type]bool))
+	schemasCache.Store(t, schema)
+	return schema
+}
+
+var bytesType = reflect.TypeFor[[]byte]()
+
+// The BSON types of the Go types the driver encodes specially
+var typeAliases = map[reflect.Type]string{
+	reflect.TypeFor[time.Time]():       "date",
+	reflect.TypeFor[bson.DateTime]():   "date",
+	reflect.TypeFor[bson.ObjectID]():   "objectId",
+	reflect.TypeFor[bson.Decimal128](): "decimal",
+	reflect.TypeFor[bson.Binary]():     "binData",
+	reflect.TypeFor[bson.Raw]():        "object",
+	reflect.TypeFor[bson.D]():          "object",
+	reflect.TypeFor[bson.A]():          "array",
+	bytesType:                          "binData",
+}
+
+// Returns the schema of a Go type, structs the schema is already inside of are only checked to be objects
+func schemaOf(t reflect.Type, inside map[reflect.Type]bool) bson.D {
+	if t.Kind() == reflect.Pointer {
+		return nullable(schemaOf(t.Elem(), inside))
+	}
+	if alias, ok := typeAliases[t]; ok {
+		return bson.D{{Key: "bsonType", Value: alias}}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return bson.D{{Key: "bsonType", Value: "string"}}
+	case reflect.Bool:
+		return bson.D{{Key: "bsonType", Value: "bool"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// The driver stores integers as int32 when they fit, whatever their Go size
+		return bson.D{{Key: "bsonType", Value: bson.A{"int", "long"}}}
+	case reflect.Float32, reflect.Float64:
+		return bson.D{{Key: "bsonType", Value: "double"}}
+	case reflect.Slice:
+		// Nil slices are stored as null
+		return nullable(bson.D{{Key: "bsonType", Value: "array"}, {Key: "items", Value: schemaOf(t.Elem(), inside)}})
+	case reflect.Array:
+		return bson.D{{Key: "bsonType", Value: "array"}, {Key: "items", Value: schemaOf(t.Elem(), inside)}}
+	case reflect.Map:
+		return nullable(bson.D{{Key: "bsonType", Value: "object"}})
+	case reflect.Struct:
+		if inside[t] {
+			return bson.D{{Key: "bsonType", Value: "object"}}
+		}
+		inside[t] = true
+		defer delete(inside, t)
+		properties := bson.D{}
+		required := bson.A{}
+		addSchemaFields(t, &properties, &required, inside)
+		schema := bson.D{{Key: "bsonType", Value: "object"}}
+		if len(required) > 0 {
+			schema = append(schema, bson.E{Key: "required", Value: required})
+		}
+		return append(schema, bson.E{Key: "properties", Value: properties})
+	}
+	// Interfaces can hold anything
+	return bson.D{}
+}
+
+// Adds the properties of the struct's fields, following inlined structs
+func addSchemaFields(t reflect.Type, properties *bson.D, required *bson.A, inside map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("bson")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		_, bsonOpts, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+bsonOpts+",", ",inline,") {
+			inlined := field.Type
+			for inlined.Kind() == reflect.Pointer {
+				inlined = inlined.Elem()
+			}
+			if inlined.Kind() == reflect.Struct {
+				addSchemaFields(inlined, properties, required, inside)
+			}
+			continue
+		}
+		key := bsonKey(field)
+		if _, ok := lookupKey(*properties, key); ok {
+			continue
+		}
+		schema := schemaOf(field.Type, inside)
+		settings := parseTag(field.Tag.Get("bark"))
+		if values, ok := settings["enum"]; ok {
+			schema = withEnum(schema, field.Type, strings.Split(values, "|"))
+		}
+		if _, ok := settings["required"]; ok {
+			*required = append(*required, key)
+		}
+		*properties = append(*properties, bson.E{Key: key, Value: schema})
+	}
+}
+
+// Returns the schema with a nullable bsonType
+func nullable(schema bson.D) bson.D {
+	for i, elem := range schema {
+		if elem.Key != "bsonType" {
+			continue
+		}
+		types, ok := elem.Value.(bson.A)
+		if !ok {
+			types = bson.A{elem.Value}
+		}
+		schema[i].Value = append(types, "null")
+	}
+	return schema
+}
+
+// Returns the schema limited to the values, slices have their elements limited instead
+func withEnum(schema bson.D, t reflect.Type, values []string) bson.D {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t != bytesType {
+		for i, elem := range schema {
+			if items, ok := elem.Value.(bson.D); ok && elem.Key == "items" {
+				schema[i].Value = withEnum(items, t.Elem(), values)
+			}
+		}
+		return schema
+	}
+	enum := bson.A{}
+	for _, value := range values {
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				enum = append(enum, n)
+			}
+		case reflect.Float32, reflect.Float64:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				enum = append(enum, f)
+			}
+		default:
+			enum = append(enum, value)
+		}
+	}
+	return append(schema, bson.E{Key: "enum", Value: enum})
+}
+
+// How the schema installed on a collection differed from the one derived from its model
+type SchemaDiff struct {
+	// Fields the model has that the installed schema didn't, every field if there was no schema
+	Added []string
+	// Fields the installed schema had that the model doesn't
+	Removed []string
+	// Fields whose type, values or requiredness differed
+	Changed []string
+	// The collection had a different validation level or action
+	LevelChanged  bool
+	ActionChanged bool
+}
+
+// Returns true if the installed schema and settings matched
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.LevelChanged && !d.ActionChanged
+}
+
+// Returns readable report of the differences
+func (d *SchemaDiff) String() string {
+	return fmt.Sprintf("Added: %v, Removed: %v, Changed: %v, Level changed: %t, Action changed: %t",
+		d.Added, d.Removed, d.Changed, d.LevelChanged, d.ActionChanged)
+}
+
+// Installs the schema derived from the model as the collection's validator, see SchemaFor and SetValidation
+// Creates the collection if it doesn't exist, otherwise the validator is replaced with collMod when it differs
+// Returns how the installed schema differed, an empty diff means nothing was changed
+func (c *Collection[T]) EnsureSchema(ctx context.Context) (*SchemaDiff, error) {
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to install schema on: %w", err)
+	}
+	cfg := configFor(c.Name)
+	schema := SchemaFor[T]()
+	validator := bson.D{{Key: "$jsonSchema", Value: schema}}
+	level, action := cfg.currentValidation()
+	spec, err := backend.Specification(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting collection options: %w", err)
+	}
+	installed := struct {
+		Validator struct {
+			Schema bson.D `bson:"$jsonSchema"`
+		} `bson:"validator"`
+		Level  ValidationLevel  `bson:"validationLevel"`
+		Action ValidationAction `bson:"validationAction"`
+	}{}
+	if spec != nil && len(spec.Options) > 0 {
+		if err := bson.Unmarshal(spec.Options, &installed); err != nil {
+			return nil, fmt.Errorf("error decoding collection options: %w", err)
+		}
+	}
+	diff := &SchemaDiff{LevelChanged: installed.Level != level, ActionChanged: installed.Action != action}
+	desired, err := toDocument(schema)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding schema: %w", err)
+	}
+	diffSchemas("", installed.Validator.Schema, desired, diff)
+	if spec == nil {
+		opts := cfg.createOptions().SetValidator(validator).SetValidationLevel(string(level)).SetValidationAction(string(action))
+		if err := backend.CreateCollection(ctx, opts); err != nil {
+			return nil, fmt.Errorf("error creating collection with schema: %w", err)
+		}
+		return diff, nil
+	}
+	if diff.Empty() {
+		return diff, nil
+	}
+	err = backend.ModifyCollection(ctx, bson.D{
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: string(level)},
+		{Key: "validationAction", Value: string(action)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error installing schema: %w", err)
+	}
+	return diff, nil
+}
+
+// Adds the differences between the properties of two object schemas to the diff, with keys under the prefix
+func diffSchemas(prefix string, installed bson.D, desired bson.D, diff *SchemaDiff) {
+	installedProperties := schemaProperties(installed)
+	desiredProperties := schemaProperties(desired)
+	installedRequired := schemaRequired(installed)
+	desiredRequired := schemaRequired(desired)
+	for _, property := range desiredProperties {
+		key := prefix + property.Key
+		before, ok := lookupKey(installedProperties, property.Key)
+		if !ok {
+			diff.Added = append(diff.Added, key)
+			continue
+		}
+		beforeSchema, _ := before.(bson.D)
+		afterSchema, _ := property.Value.(bson.D)
+		if installedRequired[property.Key] != desiredRequired[property.Key] ||
+			!sameDocument(shallowSchema(beforeSchema), shallowSchema(afterSchema)) {
+			diff.Changed = append(diff.Changed, key)
+		}
+		diffSchemas(key+".", beforeSchema, afterSchema, diff)
+		beforeItems, _ := lookupKey(beforeSchema, "items")
+		afterItems, _ := lookupKey(afterSchema, "items")
+		if beforeItems, ok := beforeItems.(bson.D); ok {
+			afterItems, _ := afterItems.(bson.D)
+			diffSchemas(key+".", beforeItems, afterItems, diff)
+		}
+	}
+	for _, property := range installedProperties {
+		if _, ok := lookupKey(desiredProperties, property.Key); !ok {
+			diff.Removed = append(diff.Removed, prefix+property.Key)
+		}
+	}
+}
+
+// Returns the properties of an object schema
+func schemaProperties(schema bson.D) bson.D {
+	properties, _ := lookupKey(schema, "properties")
+	doc, _ := properties.(bson.D)
+	return doc
+}
+
+// Returns the required properties of an object schema
+func schemaRequired(schema bson.D) map[string]bool {
+	required := make(map[string]bool)
+	names, _ := lookupKey(schema, "required")
+	array, _ := names.(bson.A)
+	for _, name := range array {
+		required[fmt.Sprint(name)] = true
+	}
+	return required
+}
+
+// Returns the schema without the parts compared on their own: properties, required and the properties of items
+func shallowSchema(schema bson.D) bson.D {
+	shallow := bson.D{}
+	for _, elem := range schema {
+		switch elem.Key {
+		case "properties", "required":
+		case "items":
+			items, _ := elem.Value.(bson.D)
+			shallow = append(shallow, bson.E{Key: "items", Value: shallowSchema(items)})
+		default:
+			shallow = append(shallow, elem)
+		}
+	}
+	return shallow
+}
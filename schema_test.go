@@ -0,0 +1,188 @@
+package bark_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type Breed struct {
+	Name    string   `bson:"Name"`
+	Origins []string `bson:"Origins" bark:"enum=uk|us|fr"`
+}
+
+type Kennel struct {
+	bark.Model `bson:",inline"`
+	Name       string   `bson:"Name" bark:"required"`
+	Size       string   `bson:"Size" bark:"enum=small|large"`
+	Rating     *float64 `bson:"Rating,omitempty"`
+	Breeds     []Breed  `bson:"Breeds"`
+	Notes      any      `bson:"Notes"`
+}
+
+type OldKennel struct {
+	bark.Model `bson:",inline"`
+	Name       string `bson:"Name"`
+	Size       int    `bson:"Size"`
+	Legacy     string `bson:"Legacy"`
+}
+
+// Returns the schema of the property at the dotted path
+func propertySchema(schema bson.D, path ...string) bson.D {
+	for _, key := range path {
+		for _, elem := range schema {
+			if elem.Key == "items" {
+				schema = elem.Value.(bson.D)
+			}
+		}
+		var properties bson.D
+		for _, elem := range schema {
+			if elem.Key == "properties" {
+				properties = elem.Value.(bson.D)
+			}
+		}
+		schema = nil
+		for _, elem := range properties {
+			if elem.Key == key {
+				schema = elem.Value.(bson.D)
+			}
+		}
+	}
+	return schema
+}
+
+func schemaValue(schema bson.D, key string) any {
+	for _, elem := range schema {
+		if elem.Key == key {
+			return elem.Value
+		}
+	}
+	return nil
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := bark.SchemaFor[Kennel]()
+	if schemaValue(schema, "bsonType") != "object" {
+		t.Errorf("Expected an object schema, got %v", schema)
+	}
+	if required := schemaValue(schema, "required"); len(required.(bson.A)) != 1 || required.(bson.A)[0] != "Name" {
+		t.Errorf("Expected Name to be required, got %v", required)
+	}
+	tests := []struct {
+		path     []string
+		bsonType any
+		enum     any
+	}{
+		{[]string{"_id"}, "string", nil},
+		{[]string{"CreatedOn"}, "date", nil},
+		{[]string{"Version"}, bson.A{"int", "long"}, nil},
+		{[]string{"Name"}, "string", nil},
+		{[]string{"Size"}, "string", bson.A{"small", "large"}},
+		{[]string{"Rating"}, bson.A{"double", "null"}, nil},
+		{[]string{"Breeds"}, bson.A{"array", "null"}, nil},
+		{[]string{"Breeds", "Name"}, "string", nil},
+		{[]string{"Breeds", "Origins"}, bson.A{"array", "null"}, nil},
+		{[]string{"Notes"}, nil, nil},
+	}
+	for _, test := range tests {
+		property := propertySchema(schema, test.path...)
+		if property == nil {
+			t.Errorf("Expected a schema for %v", test.path)
+			continue
+		}
+		if bsonType := schemaValue(property, "bsonType"); !sameValue(bsonType, test.bsonType) {
+			t.Errorf("Expected %v to be %v, got %v", test.path, test.bsonType, bsonType)
+		}
+		if enum := schemaValue(property, "enum"); !sameValue(enum, test.enum) {
+			t.Errorf("Expected %v to allow %v, got %v", test.path, test.enum, enum)
+		}
+	}
+	origins := propertySchema(schema, "Breeds", "Origins")
+	if enum := schemaValue(schemaValue(origins, "items").(bson.D), "enum"); !sameValue(enum, bson.A{"uk", "us", "fr"}) {
+		t.Errorf("Expected the origins to be limited, got %v", enum)
+	}
+	if propertySchema(schema, "collection") != nil || propertySchema(schema, "CollectionName") != nil {
+		t.Error("Expected unexported and bson:\"-\" fields to be left out")
+	}
+}
+
+func sameValue(a any, b any) bool {
+	x, _ := bson.Marshal(bson.D{{Key: "v", Value: a}})
+	y, _ := bson.Marshal(bson.D{{Key: "v", Value: b}})
+	return slices.Equal(x, y)
+}
+
+func TestEnsureSchema(t *testing.T) {
+	db := bark.NewMemoryDb()
+	ctx := bark.WithMemoryDb(setupTest("EnsureSchema", "2024-03-27T19:55:38.782Z", t), db)
+
+	t.Run("Creates the collection with the schema", func(t *testing.T) {
+		diff, err := bark.NewCollection[*OldKennel]("kennels").EnsureSchema(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Contains(diff.Added, "Legacy") || !diff.LevelChanged || !diff.ActionChanged {
+			t.Errorf("Expected every field to be added, got %v", diff)
+		}
+		opts := db.CollectionOptions("kennels")
+		if opts == nil || opts.Validator == nil || *opts.ValidationLevel != "strict" || *opts.ValidationAction != "error" {
+			t.Fatalf("Expected a strict validator, got %+v", opts)
+		}
+		diff, err = bark.NewCollection[*OldKennel]("kennels").EnsureSchema(ctx)
+		if err != nil || !diff.Empty() {
+			t.Errorf("Expected no changes the second time, got %v and %v", diff, err)
+		}
+	})
+	t.Run("Reports how the installed schema differs", func(t *testing.T) {
+		diff, err := bark.NewCollection[*Kennel]("kennels").EnsureSchema(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(diff.Added, []string{"Rating", "Breeds", "Notes"}) {
+			t.Errorf("Expected Rating, Breeds and Notes to be added, got %v", diff.Added)
+		}
+		if !slices.Equal(diff.Removed, []string{"Legacy"}) {
+			t.Errorf("Expected Legacy to be removed, got %v", diff.Removed)
+		}
+		if !slices.Equal(diff.Changed, []string{"Name", "Size"}) {
+			t.Errorf("Expected Name and Size to change, got %v", diff.Changed)
+		}
+		if diff.LevelChanged || diff.ActionChanged {
+			t.Errorf("Expected the same level and action, got %v", diff)
+		}
+	})
+	t.Run("Rejects invalid documents", func(t *testing.T) {
+		kennel := &Kennel{Model: bark.NewModel("kennels"), Name: "Paws", Size: "small", Breeds: []Breed{{Name: "Collie", Origins: []string{"uk"}}}}
+		if _, err := kennel.SaveModel(kennel, ctx); err != nil {
+			t.Fatalf("Expected a valid kennel to save, got %v", err)
+		}
+		kennel.Breeds[0].Origins = []string{"mars"}
+		_, err := kennel.SaveModel(kennel, ctx)
+		var writeErr mongo.WriteException
+		if !errors.As(err, &writeErr) || !writeErr.HasErrorCode(121) {
+			t.Errorf("Expected a validation failure, got %v", err)
+		}
+		backend, _ := bark.NewCollection[*Kennel]("kennels").Backend(ctx)
+		if _, err := backend.InsertOne(ctx, bson.M{"_id": "k2", "Size": "small"}); err == nil {
+			t.Error("Expected a kennel without a name to be rejected")
+		}
+	})
+	t.Run("Changes the validation settings", func(t *testing.T) {
+		kennels := bark.NewCollection[*Kennel]("kennels").SetValidation(bark.ValidationLevelModerate, bark.ValidationActionWarn)
+		diff, err := kennels.EnsureSchema(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !diff.LevelChanged || !diff.ActionChanged || len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+			t.Errorf("Expected only the settings to change, got %v", diff)
+		}
+		backend, _ := kennels.Backend(ctx)
+		if _, err := backend.InsertOne(ctx, bson.M{"_id": "k3", "Size": "huge"}); err != nil {
+			t.Errorf("Expected invalid documents to be let through with a warning, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,342 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrNoTextFields = errors.New("model has no fields tagged for text search")
+
+// A field included in the text index, declared with `bark:"text"` or `bark:"text=<weight>"`
+type textField struct {
+	key    string
+	weight int
+}
+
+var textFieldsCache sync.Map
+
+// Returns the text fields declared on the model type
+func textFieldsOf(t reflect.Type) []textField {
+	if cached, ok := textFieldsCache.Load(t); ok {
+		return cached.([]textField)
+	}
+	var fields []textField
+	for _, tagged := range taggedFields(t, "text") {
+		weight, err := strconv.Atoi(tagged.value)
+		if err != nil || weight < 1 {
+			weight = 1
+		}
+		fields = append(fields, textField{key: tagged.key, weight: weight})
+	}
+	textFieldsCache.Store(t, fields)
+	return fields
+}
+
+// Creates the text index over the model's fields tagged `bark:"text"` or `bark:"text=<weight>"`
+// The default language is used for stemming and stop words, "" for MongoDB's default of english
+func (c *Collection[T]) EnsureTextIndex(defaultLanguage string, ctx context.Context) (string, error) {
+	fields := textFieldsOf(reflect.TypeFor[T]())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNoTextFields, reflect.TypeFor[T]())
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get collection to create text index on: %w", err)
+	}
+	keys := bson.D{}
+	weights := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field.key, Value: "text"})
+		weights = append(weights, bson.E{Key: field.key, Value: field.weight})
+	}
+	opts := options.Index().SetWeights(weights)
+	if defaultLanguage != "" {
+		opts.SetDefaultLanguage(defaultLanguage)
+	}
+	name, err := backend.CreateIndex(ctx, keys, opts)
+	if err != nil {
+		return "", fmt.Errorf("error creating text index: %w", err)
+	}
+	return name, nil
+}
+
+// Options for Collection.Search
+type SearchOptions struct {
+	// The language of the query, "" for the index's default language
+	Language string
+	// Sorts the results, nil sorts them by relevance
+	Sort any
+	Skip int64
+	// Largest number of results, 0 for no limit
+	Limit int64
+}
+
+// A document found by a text search with its relevance
+type SearchResult[T any] struct {
+	Doc   T
+	Score float64
+}
+
+// The key the text score is projected into
+const scoreKey = "_barkScore"
+
+// Finds the documents matching the text query and the filter, most relevant first
+// The query uses MongoDB's $text syntax: words match any of them, "quoted phrases" must all match
+// and -words exclude documents
+// The collection needs a text index, see EnsureTextIndex
+// The in-memory backend matches words with regular expressions over the tagged fields instead,
+// so it has no stemming or stop words and its scores only roughly follow MongoDB's
+func (c *Collection[T]) Search(query string, filter bson.M, opts *SearchOptions, ctx context.Context) ([]SearchResult[T], error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to search: %w", err)
+	}
+	if memoryDbFrom(ctx) != nil {
+		return c.searchInMemory(backend, query, filter, opts, ctx)
+	}
+	text := bson.M{"$search": query}
+	if opts.Language != "" {
+		text["$language"] = opts.Language
+	}
+	search := bson.M{"$text": text}
+	for key, value := range filter {
+		search[key] = value
+	}
+	score := bson.M{"$meta": "textScore"}
+	findOpts := options.Find().SetProjection(bson.M{scoreKey: score})
+	if opts.Sort != nil {
+		findOpts.SetSort(opts.Sort)
+	} else {
+		findOpts.SetSort(bson.M{scoreKey: score})
+	}
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cursor, err := backend.Find(ctx, search, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+	defer cursor.Close(ctx)
+	var results []SearchResult[T]
+	for cursor.Next(ctx) {
+		result, err := c.decodeScored(backend, cursor.Current(), ctx)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+	return results, nil
+}
+
+// Decodes a search result, splitting off its score so it isn't decoded or written back with the model
+func (c *Collection[T]) decodeScored(backend Backend, raw bson.Raw, ctx context.Context) (SearchResult[T], error) {
+	data, extra, err := splitDocument(raw, func(key string) bool { return key == scoreKey })
+	if err != nil {
+		return SearchResult[T]{}, fmt.Errorf("error decoding document: %w", err)
+	}
+	var result SearchResult[T]
+	result.Score, _ = toFloat(extra[scoreKey])
+	if err := c.decode(backend, data, &result.Doc, ctx); err != nil {
+		return SearchResult[T]{}, fmt.Errorf("error decoding document: %w", err)
+	}
+	result.Doc.SetCollectionName(c.Name)
+	return result, nil
+}
+
+// The parts of a $text query
+type textQuery struct {
+	words    []string
+	phrases  []string
+	excluded []string
+}
+
+// Splits a query into words, "quoted phrases" and -excluded words, all lower case
+func parseTextQuery(query string) textQuery {
+	var parsed textQuery
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.ToLower(strings.TrimSpace(part)); phrase != "" {
+				parsed.phrases = append(parsed.phrases, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			excluded := strings.HasPrefix(word, "-")
+			word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			}))
+			switch {
+			case word == "":
+			case excluded:
+				parsed.excluded = append(parsed.excluded, word)
+			default:
+				parsed.words = append(parsed.words, word)
+			}
+		}
+	}
+	return parsed
+}
+
+// Returns the words and phrases a document must contain one of to match
+func (q textQuery) terms() []string {
+	return append(append([]string{}, q.words...), q.phrases...)
+}
+
+// Searches the in-memory backend by matching the query's words against the text fields
+func (c *Collection[T]) searchInMemory(backend Backend, query string, filter bson.M, opts *SearchOptions, ctx context.Context) ([]SearchResult[T], error) {
+	fields := textFieldsOf(reflect.TypeFor[T]())
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoTextFields, reflect.TypeFor[T]())
+	}
+	parsed := parseTextQuery(query)
+	terms := parsed.terms()
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var matches bson.A
+	for _, field := range fields {
+		for _, term := range terms {
+			matches = append(matches, bson.M{field.key: bson.M{"$regex": regexp.QuoteMeta(term), "$options": "i"}})
+		}
+	}
+	search := bson.M{"$or": matches}
+	if len(filter) > 0 {
+		search = bson.M{"$and": bson.A{filter, search}}
+	}
+	findOpts := options.Find()
+	if opts.Sort != nil {
+		findOpts.SetSort(opts.Sort)
+	}
+	cursor, err := backend.Find(ctx, search, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+	defer cursor.Close(ctx)
+	var results []SearchResult[T]
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := bson.Unmarshal(cursor.Current(), &doc); err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		score, ok := scoreDocument(doc, fields, parsed)
+		if !ok {
+			continue
+		}
+		result, err := c.decodeScored(backend, cursor.Current(), ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.Score = score
+		results = append(results, result)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+	if opts.Sort == nil {
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	}
+	// Paging comes last since documents only match once they are scored
+	start := min(int(opts.Skip), len(results))
+	results = results[start:]
+	if opts.Limit > 0 && int(opts.Limit) < len(results) {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// Scores the document by how often the terms appear in its text fields, weighted by field
+// Returns false if the document contains an excluded word or lacks a phrase
+func scoreDocument(doc bson.D, fields []textField, query textQuery) (float64, bool) {
+	score := 0.0
+	found := make(map[string]bool)
+	for _, field := range fields {
+		for _, value := range expandArrays(resolvePath(doc, field.key)) {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			text = strings.ToLower(text)
+			words := textWords(text)
+			for _, excluded := range query.excluded {
+				if countWord(words, excluded) > 0 {
+					return 0, false
+				}
+			}
+			for _, word := range query.words {
+				if n := countWord(words, word); n > 0 {
+					found[word] = true
+					score += float64(n * field.weight)
+				}
+			}
+			for _, phrase := range query.phrases {
+				if n := strings.Count(text, phrase); n > 0 {
+					found[phrase] = true
+					score += float64(n * field.weight)
+				}
+			}
+		}
+	}
+	for _, phrase := range query.phrases {
+		if !found[phrase] {
+			return 0, false
+		}
+	}
+	return score, score > 0
+}
+
+// Returns the lower case words of the text
+func textWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Returns how many of the words are the query word, allowing a plural ending as a rough stand-in for stemming
+func countWord(words []string, word string) int {
+	n := 0
+	for _, w := range words {
+		if rest, ok := strings.CutPrefix(w, word); ok && (rest == "" || rest == "s" || rest == "es") {
+			n++
+		}
+	}
+	return n
+}
+
+// Wraps each word and phrase of the query found in the text with pre and post, ignoring case
+// Useful for showing why a search result matched, e.g. Highlight(dog.Name, query, "<mark>", "</mark>")
+func Highlight(text string, query string, pre string, post string) string {
+	terms := parseTextQuery(query).terms()
+	if len(terms) == 0 {
+		return text
+	}
+	// Longer terms first so a phrase wins over the words in it
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	patterns := make([]string, len(terms))
+	for i, term := range terms {
+		patterns[i] = regexp.QuoteMeta(term)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		return pre + match + post
+	})
+}
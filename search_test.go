@@ -0,0 +1,89 @@
+package bark_test
+
+import (
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Article struct {
+	bark.Model `bson:",inline"`
+	Title      string `bson:"Title" bark:"text=5"`
+	Body       string `bson:"Body" bark:"text"`
+	Author     string `bson:"Author"`
+}
+
+func TestSearch(t *testing.T) {
+	db := bark.NewMemoryDb()
+	ctx := bark.WithMemoryDb(setupTest("Search", "2024-03-27T19:55:38.782Z", t), db)
+	insertAll("articles", ctx, t,
+		bson.M{"_id": "a1", "Id": "a1", "Title": "Training your dog", "Body": "Dogs love treats", "Author": "ann"},
+		bson.M{"_id": "a2", "Id": "a2", "Title": "Cat care", "Body": "A dog and a cat can be friends", "Author": "bob"},
+		bson.M{"_id": "a3", "Id": "a3", "Title": "Feeding cats", "Body": "Cats need protein", "Author": "ann"})
+	articles := bark.NewCollection[*Article]("articles")
+
+	t.Run("Creates a weighted text index", func(t *testing.T) {
+		name, err := articles.EnsureTextIndex("english", ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		keys := db.Indexes("articles")[name]
+		if len(keys) != 2 || keys[0] != (bson.E{Key: "Title", Value: "text"}) || keys[1] != (bson.E{Key: "Body", Value: "text"}) {
+			t.Errorf("Expected a text index on Title and Body, got %v", keys)
+		}
+		if _, err := bark.NewCollection[*Dog](DogCollectionName).EnsureTextIndex("", ctx); err == nil {
+			t.Error("Expected an error for a model without text fields")
+		}
+	})
+	t.Run("Ranks matches by relevance", func(t *testing.T) {
+		results, err := articles.Search("dog", nil, nil, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 2 || results[0].Doc.Id != "a1" || results[1].Doc.Id != "a2" {
+			t.Fatalf("Expected the title match first, got %v", results)
+		}
+		if results[0].Score <= results[1].Score {
+			t.Errorf("Expected descending scores, got %v and %v", results[0].Score, results[1].Score)
+		}
+	})
+	t.Run("Filters, excludes and pages", func(t *testing.T) {
+		results, err := articles.Search("cat -dog", bson.M{"Author": "ann"}, nil, ctx)
+		if err != nil || len(results) != 1 || results[0].Doc.Id != "a3" {
+			t.Errorf("Expected only a3, got %v and %v", results, err)
+		}
+		results, err = articles.Search("dog -cat", nil, nil, ctx)
+		if err != nil || len(results) != 1 || results[0].Doc.Id != "a1" {
+			t.Errorf("Expected only a1, got %v and %v", results, err)
+		}
+		insertAll("articles", ctx, t, bson.M{"_id": "a4", "Id": "a4", "Title": "Choosing a dog category", "Author": "cy"})
+		results, err = articles.Search("dog -cat", bson.M{"Author": "cy"}, nil, ctx)
+		if err != nil || len(results) != 1 || results[0].Doc.Id != "a4" {
+			t.Errorf("Expected excluding cat to keep a4 with category, got %v and %v", results, err)
+		}
+		results, err = articles.Search(`"cat care" feeding`, nil, nil, ctx)
+		if err != nil || len(results) != 1 || results[0].Doc.Id != "a2" {
+			t.Errorf("Expected only the phrase match, got %v and %v", results, err)
+		}
+		results, err = articles.Search("cat dog", nil, &bark.SearchOptions{Skip: 1, Limit: 1}, ctx)
+		if err != nil || len(results) != 1 {
+			t.Errorf("Expected one result, got %v and %v", results, err)
+		}
+	})
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text, query, expected string
+	}{
+		{"Training your Dog", "dog", "Training your <b>Dog</b>"},
+		{"Cat care for cats", `"cat care" cats -dog`, "<b>Cat care</b> for <b>cats</b>"},
+		{"Nothing here", "", "Nothing here"},
+	}
+	for _, test := range tests {
+		if got := bark.Highlight(test.text, test.query, "<b>", "</b>"); got != test.expected {
+			t.Errorf("Highlight(%q, %q) = %q, expected %q", test.text, test.query, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+#!/bin/bash
+
+set -e
+
+# Starts a single node replica set for the tests that need one (transactions and change streams)
+# Usage: ./start_test_rs.sh [port]
+# Then run the tests with MONGO_URI=mongodb://localhost:<port>/?replicaSet=rs0
+
+PORT=${1:-27017}
+DBPATH=$(mktemp -d -t bark-rs-XXXXXX)
+
+# Prefer a local mongod, fall back to docker
+if command -v mongod >/dev/null 2>&1; then
+  mongod --replSet rs0 --port "$PORT" --bind_ip localhost --dbpath "$DBPATH" --fork --logpath "$DBPATH/mongod.log"
+  SHELL_CMD=(mongosh --quiet --port "$PORT")
+elif command -v docker >/dev/null 2>&1; then
+  docker run -d --rm --name bark-test-rs -p "$PORT:$PORT" mongo:7 --replSet rs0 --port "$PORT" --bind_ip_all
+  SHELL_CMD=(docker exec bark-test-rs mongosh --quiet --port "$PORT")
+else
+  echo "Either mongod or docker is required"
+  exit 1
+fi
+
+# Wait for the server to accept connections
+for i in $(seq 1 30); do
+  if "${SHELL_CMD[@]}" --eval "db.runCommand({ping: 1})" >/dev/null 2>&1; then
+    break
+  fi
+  sleep 1
+done
+
+"${SHELL_CMD[@]}" --eval "rs.initiate({_id: 'rs0', members: [{_id: 0, host: 'localhost:$PORT'}]})"
+
+# Wait for the node to become primary
+for i in $(seq 1 30); do
+  if [[ $("${SHELL_CMD[@]}" --eval "db.hello().isWritablePrimary") == "true" ]]; then
+    echo "Replica set rs0 is ready on port $PORT"
+    exit 0
+  fi
+  sleep 1
+done
+
+echo "Replica set did not become primary in time"
+exit 1
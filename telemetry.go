@@ -0,0 +1,237 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/jaredtmartin/bark-go-mongo"
+
+var dbSystem = attribute.String("db.system", "mongodb")
+
+// The tracer and instruments bark reports to, nil until a provider is set
+var telemetryState atomic.Pointer[telemetry]
+
+var telemetryMu sync.Mutex
+var tracerProvider trace.TracerProvider
+var meterProvider metric.MeterProvider
+
+// Sets the provider of the tracer bark creates spans with, nil stops tracing
+// Telemetry is off until a tracer or meter provider is set
+func SetTracerProvider(tp trace.TracerProvider) error {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+	tracerProvider = tp
+	return updateTelemetry()
+}
+
+// Sets the provider of the meter bark records metrics with, nil stops recording
+// Telemetry is off until a tracer or meter provider is set
+func SetMeterProvider(mp metric.MeterProvider) error {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+	meterProvider = mp
+	return updateTelemetry()
+}
+
+// Rebuilds the telemetry from the providers, the caller must hold telemetryMu
+// The previous telemetry's pool callback is unregistered so callbacks don't pile up on the meter
+func updateTelemetry() error {
+	if tracerProvider == nil && meterProvider == nil {
+		return swapTelemetry(nil)
+	}
+	tp, mp := tracerProvider, meterProvider
+	if tp == nil {
+		tp = tracenoop.NewTracerProvider()
+	}
+	if mp == nil {
+		mp = metricnoop.NewMeterProvider()
+	}
+	t, err := newTelemetry(tp, mp)
+	if err != nil {
+		return err
+	}
+	return swapTelemetry(t)
+}
+
+// Replaces the telemetry and unregisters the previous one's pool callback, the caller must hold telemetryMu
+func swapTelemetry(t *telemetry) error {
+	previous := telemetryState.Swap(t)
+	if previous == nil {
+		return nil
+	}
+	if err := previous.pool.Unregister(); err != nil {
+		return fmt.Errorf("error unregistering pool gauges: %w", err)
+	}
+	return nil
+}
+
+// The tracer and instruments for bark operations
+type telemetry struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+	// The callback that observes the pool gauges
+	pool metric.Registration
+}
+
+// Creates the tracer and instruments from the providers
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) (*telemetry, error) {
+	meter := mp.Meter(instrumentationName)
+	duration, err := meter.Float64Histogram("bark.operation.duration",
+		metric.WithDescription("Duration of bark operations"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating duration histogram: %w", err)
+	}
+	errorCount, err := meter.Int64Counter("bark.operation.errors",
+		metric.WithDescription("Number of bark operations that failed"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating error counter: %w", err)
+	}
+	open, err := meter.Int64ObservableGauge("bark.pool.connections",
+		metric.WithDescription("Number of open connections in the pool"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating pool connections gauge: %w", err)
+	}
+	inUse, err := meter.Int64ObservableGauge("bark.pool.connections.in_use",
+		metric.WithDescription("Number of connections checked out of the pool"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating pool in use gauge: %w", err)
+	}
+	registration, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		attrs := metric.WithAttributes(dbSystem)
+		o.ObserveInt64(open, pool.open.Load(), attrs)
+		o.ObserveInt64(inUse, pool.inUse.Load(), attrs)
+		return nil
+	}, open, inUse)
+	if err != nil {
+		return nil, fmt.Errorf("error registering pool gauges: %w", err)
+	}
+	return &telemetry{tracer: tp.Tracer(instrumentationName), duration: duration, errors: errorCount, pool: registration}, nil
+}
+
+// Traces the operation and records its duration and errors
+// The span for Find and Aggregate stays open until its cursor is closed
+func (t *telemetry) intercept(ctx context.Context, op *Operation, next func(ctx context.Context) error) error {
+	start := time.Now()
+	attrs := []attribute.KeyValue{
+		dbSystem,
+		attribute.String("db.name", op.Database),
+		attribute.String("db.operation", op.Name),
+		attribute.String("db.mongodb.collection", op.Collection),
+	}
+	ctx, span := t.tracer.Start(ctx, op.Name+" "+op.Collection,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	err := next(ctx)
+	if err == nil && op.Cursor != nil {
+		op.Cursor = &tracedCursor{Cursor: op.Cursor, end: func(documents int64, err error) {
+			t.end(ctx, span, start, attrs, documents, err)
+		}}
+		return nil
+	}
+	t.end(ctx, span, start, attrs, op.Documents, err)
+	return err
+}
+
+// Ends the span and records the metrics for an operation
+func (t *telemetry) end(ctx context.Context, span trace.Span, start time.Time, attrs []attribute.KeyValue, documents int64, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = nil
+	}
+	span.SetAttributes(attribute.Int64("bark.documents", documents))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		t.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	t.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	span.End()
+}
+
+// A cursor that ends its operation's span when it is closed
+type tracedCursor struct {
+	Cursor
+	end       func(documents int64, err error)
+	documents int64
+	ended     bool
+}
+
+func (c *tracedCursor) Next(ctx context.Context) bool {
+	if c.Cursor.Next(ctx) {
+		c.documents++
+		return true
+	}
+	return false
+}
+
+func (c *tracedCursor) Close(ctx context.Context) error {
+	err := c.Cursor.Close(ctx)
+	if !c.ended {
+		c.ended = true
+		cursorErr := c.Cursor.Err()
+		if cursorErr == nil {
+			cursorErr = err
+		}
+		c.end(c.documents, cursorErr)
+	}
+	return err
+}
+
+// Starts a span for connecting to a database, the returned func ends it
+func traceConnect(dbName string) func(err error) {
+	t := telemetryState.Load()
+	if t == nil {
+		return func(error) {}
+	}
+	_, span := t.tracer.Start(context.Background(), "connect",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, attribute.String("db.name", dbName)))
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Connection pool counts for the shared client, kept up to date by its pool monitor
+type poolStats struct {
+	open  atomic.Int64
+	inUse atomic.Int64
+}
+
+var pool poolStats
+
+// Returns a pool monitor that keeps the pool counts
+func newPoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				pool.open.Add(1)
+			case event.ConnectionClosed:
+				pool.open.Add(-1)
+			case event.ConnectionCheckedOut:
+				pool.inUse.Add(1)
+			case event.ConnectionCheckedIn:
+				pool.inUse.Add(-1)
+			}
+		},
+	}
+}
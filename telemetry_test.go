@@ -0,0 +1,131 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Sets up in-process exporters and returns them, telemetry is turned off when the test ends
+func setupTelemetry(t *testing.T) (*tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	if err := bark.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))); err != nil {
+		t.Fatalf("Failed to set tracer provider: %v", err)
+	}
+	if err := bark.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))); err != nil {
+		t.Fatalf("Failed to set meter provider: %v", err)
+	}
+	t.Cleanup(func() {
+		bark.SetTracerProvider(nil)
+		bark.SetMeterProvider(nil)
+	})
+	return spans, reader
+}
+
+// Returns the value of the attribute on the span
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+func TestTelemetry(t *testing.T) {
+	ctx := setupMemoryTest("Telemetry", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111"}, {Name: "Spot", Id: "2222"}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	spans, reader := setupTelemetry(t)
+
+	t.Run("Traces operations with document counts", func(t *testing.T) {
+		if _, err := dogs.Find(bson.M{}, nil, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ended := spans.Ended()
+		if len(ended) != 1 {
+			t.Fatalf("Expected 1 span, got %d", len(ended))
+		}
+		span := ended[0]
+		if span.Name() != "Find dogs" {
+			t.Errorf("Expected span named Find dogs, got %s", span.Name())
+		}
+		if spanAttribute(span, "db.system").AsString() != "mongodb" || spanAttribute(span, "db.name").AsString() != "test-Telemetry" {
+			t.Errorf("Expected database attributes, got %v", span.Attributes())
+		}
+		if spanAttribute(span, "db.operation").AsString() != "Find" || spanAttribute(span, "db.mongodb.collection").AsString() != "dogs" {
+			t.Errorf("Expected operation attributes, got %v", span.Attributes())
+		}
+		if spanAttribute(span, "bark.documents").AsInt64() != 2 {
+			t.Errorf("Expected 2 documents, got %v", spanAttribute(span, "bark.documents"))
+		}
+	})
+	t.Run("Records errors", func(t *testing.T) {
+		failure := errors.New("injected failure")
+		faultCtx := bark.WithFaults(ctx, bark.NewFaults(bark.Fault{Operation: "CountDocuments", Err: failure}))
+		dogs.Count(bson.M{}, faultCtx)
+		ended := spans.Ended()
+		span := ended[len(ended)-1]
+		if span.Status().Code != codes.Error {
+			t.Errorf("Expected an error status, got %v", span.Status())
+		}
+		var data metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &data); err != nil {
+			t.Fatalf("Failed to collect metrics: %v", err)
+		}
+		metrics := map[string]metricdata.Aggregation{}
+		for _, scope := range data.ScopeMetrics {
+			for _, m := range scope.Metrics {
+				metrics[m.Name] = m.Data
+			}
+		}
+		errorCount, ok := metrics["bark.operation.errors"].(metricdata.Sum[int64])
+		if !ok || len(errorCount.DataPoints) != 1 || errorCount.DataPoints[0].Value != 1 {
+			t.Errorf("Expected 1 error to be counted, got %v", metrics["bark.operation.errors"])
+		}
+		duration, ok := metrics["bark.operation.duration"].(metricdata.Histogram[float64])
+		if !ok || len(duration.DataPoints) != 2 {
+			t.Errorf("Expected durations for Find and CountDocuments, got %v", metrics["bark.operation.duration"])
+		}
+	})
+	t.Run("Stops observing the pool on a replaced meter provider", func(t *testing.T) {
+		replaced := sdkmetric.NewManualReader()
+		if err := bark.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(replaced))); err != nil {
+			t.Fatalf("Failed to set meter provider: %v", err)
+		}
+		if err := bark.SetMeterProvider(sdkmetric.NewMeterProvider()); err != nil {
+			t.Fatalf("Failed to set meter provider: %v", err)
+		}
+		var data metricdata.ResourceMetrics
+		if err := replaced.Collect(context.Background(), &data); err != nil {
+			t.Fatalf("Failed to collect metrics: %v", err)
+		}
+		for _, scope := range data.ScopeMetrics {
+			for _, m := range scope.Metrics {
+				if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok && len(gauge.DataPoints) > 0 {
+					t.Errorf("Expected %s to stop being observed, got %v", m.Name, gauge.DataPoints)
+				}
+			}
+		}
+	})
+	t.Run("Is off by default", func(t *testing.T) {
+		bark.SetTracerProvider(nil)
+		bark.SetMeterProvider(nil)
+		before := len(spans.Ended())
+		dogs.Count(bson.M{}, ctx)
+		if len(spans.Ended()) != before {
+			t.Errorf("Expected no spans once the providers are removed")
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package bark
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The kinds of operation that get their own default timeout
+type OperationClass string
+
+const (
+	ReadOperation  OperationClass = "read"
+	WriteOperation OperationClass = "write"
+	BulkOperation  OperationClass = "bulk"
+)
+
+// Returns the class of a Backend operation
+func classOf(operation string) OperationClass {
+	switch operation {
+	case "Find", "FindOne", "CountDocuments", "Aggregate", "Distinct", "Specification":
+		return ReadOperation
+	case "InsertMany", "UpdateMany", "DeleteMany":
+		return BulkOperation
+	default:
+		return WriteOperation
+	}
+}
+
+// Deadlines given to operations whose context has none, 0 for no deadline
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Bulk  time.Duration
+}
+
+var timeoutsMu sync.RWMutex
+var defaultTimeouts Timeouts
+
+// Sets the timeouts used by collections that don't set their own
+func SetDefaultTimeouts(timeouts Timeouts) {
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	defaultTimeouts = timeouts
+}
+
+// Sets the timeouts for operations on the collection, zero fields use the default timeouts
+func (c *Collection[T]) SetTimeouts(timeouts Timeouts) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.timeouts = timeouts
+	return c
+}
+
+// Returns the collection's timeouts with the defaults filled in
+func (cfg *collectionConfig) effectiveTimeouts() Timeouts {
+	cfg.mu.RLock()
+	timeouts := cfg.timeouts
+	cfg.mu.RUnlock()
+	timeoutsMu.RLock()
+	defer timeoutsMu.RUnlock()
+	if timeouts.Read == 0 {
+		timeouts.Read = defaultTimeouts.Read
+	}
+	if timeouts.Write == 0 {
+		timeouts.Write = defaultTimeouts.Write
+	}
+	if timeouts.Bulk == 0 {
+		timeouts.Bulk = defaultTimeouts.Bulk
+	}
+	return timeouts
+}
+
+// Returns the timeout for the class of operation
+func (t Timeouts) For(class OperationClass) time.Duration {
+	switch class {
+	case ReadOperation:
+		return t.Read
+	case BulkOperation:
+		return t.Bulk
+	default:
+		return t.Write
+	}
+}
+
+// Gives the operation a deadline if its context doesn't have one
+// The deadline for Find lasts until its cursor is closed, except for tailable cursors which wait for new documents
+// for as long as the caller's context allows
+func (t Timeouts) intercept(ctx context.Context, op *Operation, next func(ctx context.Context) error) error {
+	timeout := t.For(classOf(op.Name))
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return next(ctx)
+	}
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	err := next(ctx)
+	if err == nil && op.Cursor != nil && !op.Tailable {
+		op.Cursor = &cancelingCursor{Cursor: op.Cursor, deadline: deadline, cancel: cancel}
+		return nil
+	}
+	cancel()
+	return err
+}
+
+// A cursor that keeps the operation's deadline until it is closed
+type cancelingCursor struct {
+	Cursor
+	deadline time.Time
+	cancel   context.CancelFunc
+}
+
+// Moves to the next document, stopping at the operation's deadline or when the caller's context is done
+func (c *cancelingCursor) Next(ctx context.Context) bool {
+	ctx, cancel := context.WithDeadline(ctx, c.deadline)
+	defer cancel()
+	return c.Cursor.Next(ctx)
+}
+
+func (c *cancelingCursor) Close(ctx context.Context) error {
+	defer c.cancel()
+	return c.Cursor.Close(ctx)
+}
@@ -0,0 +1,272 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var ErrNotTimeSeries = errors.New("collection isn't configured as a time series")
+
+// How a time-series collection is laid out
+type TimeSeries struct {
+	// The field holding each measurement's time, required
+	TimeField string
+	// The field holding what the measurement is about, like a sensor id, optional
+	MetaField string
+	// "seconds", "minutes" or "hours", close to the time between measurements for the same meta, optional
+	Granularity string
+	// How long measurements are kept, 0 to keep them forever
+	ExpireAfter time.Duration
+}
+
+// Makes the collection a time-series collection when it is created with EnsureCollection
+// Documents in time-series collections can't be upserted, so insert them with InsertMany instead of SaveModel
+func (c *Collection[T]) SetTimeSeries(ts TimeSeries) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.timeSeries = &ts
+	return c
+}
+
+// Returns the collection's time series layout, nil if it isn't a time series
+func (cfg *collectionConfig) currentTimeSeries() *TimeSeries {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.timeSeries
+}
+
+// Returns the time series layout of the collection, or ErrNotTimeSeries
+func (c *Collection[T]) timeSeries() (*TimeSeries, error) {
+	ts := configFor(c.Name).currentTimeSeries()
+	if ts == nil || ts.TimeField == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotTimeSeries, c.Name)
+	}
+	return ts, nil
+}
+
+// The average, minimum and maximum of a field over a span of time
+type Bucket struct {
+	// The value of the meta field, nil without one
+	Meta    any
+	Start   time.Time
+	Average float64
+	Min     float64
+	Max     float64
+	Count   int64
+}
+
+// Returns the average, minimum and maximum of the field for each bucket of the given size, oldest first
+// Measurements are bucketed by meta field as well as time when the time series has one
+// Buckets are aligned to whole units since 2000-01-01 UTC, so hourly buckets start on the hour
+func (c *Collection[T]) BucketAverages(field string, size time.Duration, filter bson.M, ctx context.Context) ([]Bucket, error) {
+	ts, err := c.timeSeries()
+	if err != nil {
+		return nil, err
+	}
+	unit, binSize := dateUnit(size)
+	if binSize == 0 {
+		return nil, fmt.Errorf("bucket size must be a whole number of milliseconds, got %v", size)
+	}
+	id := bson.D{{Key: "start", Value: bson.D{{Key: "$dateTrunc", Value: bson.D{
+		{Key: "date", Value: "$" + ts.TimeField},
+		{Key: "unit", Value: unit},
+		{Key: "binSize", Value: binSize},
+	}}}}}
+	if ts.MetaField != "" {
+		id = append(id, bson.E{Key: "meta", Value: "$" + ts.MetaField})
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: id},
+			{Key: "avg", Value: bson.D{{Key: "$avg", Value: "$" + field}}},
+			{Key: "min", Value: bson.D{{Key: "$min", Value: "$" + field}}},
+			{Key: "max", Value: bson.D{{Key: "$max", Value: "$" + field}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id.start", Value: 1}, {Key: "_id.meta", Value: 1}}}},
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to bucket: %w", err)
+	}
+	cursor, err := backend.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error bucketing: %w", err)
+	}
+	defer cursor.Close(ctx)
+	var buckets []Bucket
+	for cursor.Next(ctx) {
+		var doc struct {
+			Id struct {
+				Start time.Time `bson:"start"`
+				Meta  any       `bson:"meta"`
+			} `bson:"_id"`
+			Avg   *float64 `bson:"avg"`
+			Min   any      `bson:"min"`
+			Max   any      `bson:"max"`
+			Count int64    `bson:"count"`
+		}
+		if err := bson.Unmarshal(cursor.Current(), &doc); err != nil {
+			return nil, fmt.Errorf("error decoding bucket: %w", err)
+		}
+		bucket := Bucket{Meta: doc.Id.Meta, Start: doc.Id.Start, Count: doc.Count}
+		if doc.Avg != nil {
+			bucket.Average = *doc.Avg
+		}
+		bucket.Min, _ = toFloat(doc.Min)
+		bucket.Max, _ = toFloat(doc.Max)
+		buckets = append(buckets, bucket)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error bucketing: %w", err)
+	}
+	return buckets, nil
+}
+
+// Returns the largest $dateTrunc unit the duration is a whole number of, with the number
+func dateUnit(d time.Duration) (string, int64) {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+		{"millisecond", time.Millisecond},
+	}
+	for _, unit := range units {
+		if d > 0 && d%unit.size == 0 {
+			return unit.name, int64(d / unit.size)
+		}
+	}
+	return "", 0
+}
+
+// A field computed over a window of neighbouring documents by SetWindowFields
+type WindowField struct {
+	// The name the result is returned under
+	Name string
+	// The accumulator, one of "$avg", "$sum", "$min", "$max" or "$count"
+	Operator string
+	// The numeric field accumulated, ignored by $count
+	Field string
+	// The window in documents relative to the current one, e.g. {-2, 0} for it and the two before
+	Documents *[2]int
+	// The window in time relative to the current document, e.g. {-time.Hour, 0} for the last hour
+	// Without Documents or Range the window is the whole partition
+	Range *[2]time.Duration
+}
+
+// Options for SetWindowFields
+type WindowOptions struct {
+	Filter bson.M
+	// The field that splits the documents into separate windows, defaults to the time series' meta field
+	PartitionBy string
+	// The field the documents are ordered by, defaults to the time series' time field
+	SortBy string
+}
+
+// A document with the fields computed over its window
+type Windowed[T any] struct {
+	Doc T
+	// The computed fields by name, a field is missing if its window had no numbers
+	Fields map[string]float64
+}
+
+// The key the computed fields are put under
+const windowKey = "_barkWindow"
+
+// Computes the fields over windows of neighbouring documents with $setWindowFields, like moving averages
+// Documents are returned in window order, by partition then sort field
+func (c *Collection[T]) SetWindowFields(fields []WindowField, opts *WindowOptions, ctx context.Context) ([]Windowed[T], error) {
+	if opts == nil {
+		opts = &WindowOptions{}
+	}
+	partitionBy, sortBy := opts.PartitionBy, opts.SortBy
+	if ts := configFor(c.Name).currentTimeSeries(); ts != nil {
+		if partitionBy == "" {
+			partitionBy = ts.MetaField
+		}
+		if sortBy == "" {
+			sortBy = ts.TimeField
+		}
+	}
+	if sortBy == "" {
+		return nil, fmt.Errorf("%w: a sort field is needed", ErrNotTimeSeries)
+	}
+	output := bson.D{}
+	for _, field := range fields {
+		var arg any = "$" + field.Field
+		if field.Operator == "$count" {
+			arg = bson.D{}
+		}
+		spec := bson.D{{Key: field.Operator, Value: arg}}
+		switch {
+		case field.Documents != nil:
+			spec = append(spec, bson.E{Key: "window", Value: bson.D{{Key: "documents", Value: bson.A{field.Documents[0], field.Documents[1]}}}})
+		case field.Range != nil:
+			spec = append(spec, bson.E{Key: "window", Value: bson.D{
+				{Key: "range", Value: bson.A{field.Range[0].Milliseconds(), field.Range[1].Milliseconds()}},
+				{Key: "unit", Value: "millisecond"},
+			}})
+		}
+		output = append(output, bson.E{Key: windowKey + "." + field.Name, Value: spec})
+	}
+	stage := bson.D{}
+	if partitionBy != "" {
+		stage = append(stage, bson.E{Key: "partitionBy", Value: "$" + partitionBy})
+	}
+	stage = append(stage,
+		bson.E{Key: "sortBy", Value: bson.D{{Key: sortBy, Value: 1}}},
+		bson.E{Key: "output", Value: output})
+	filter := opts.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$setWindowFields", Value: stage}},
+	}
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to compute windows in: %w", err)
+	}
+	cursor, err := backend.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error computing windows: %w", err)
+	}
+	defer cursor.Close(ctx)
+	var results []Windowed[T]
+	for cursor.Next(ctx) {
+		raw, extra, err := splitDocument(cursor.Current(), func(key string) bool { return key == windowKey })
+		if err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		result := Windowed[T]{Fields: make(map[string]float64)}
+		computed, _ := extra[windowKey].(bson.D)
+		for _, elem := range computed {
+			if value, ok := toFloat(elem.Value); ok {
+				result.Fields[elem.Key] = value
+			}
+		}
+		if err := c.decode(backend, raw, &result.Doc, ctx); err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		result.Doc.SetCollectionName(c.Name)
+		results = append(results, result)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error computing windows: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,130 @@
+package bark_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Reading struct {
+	bark.Model `bson:",inline"`
+	Sensor     string    `bson:"Sensor"`
+	Time       time.Time `bson:"Time"`
+	Value      float64   `bson:"Value"`
+}
+
+func TestTimeSeries(t *testing.T) {
+	db := bark.NewMemoryDb()
+	ctx := bark.WithMemoryDb(setupTest("TimeSeries", "2024-03-27T19:55:38.782Z", t), db)
+	readings := bark.NewCollection[*Reading]("readings").SetTimeSeries(bark.TimeSeries{
+		TimeField:   "Time",
+		MetaField:   "Sensor",
+		Granularity: "minutes",
+		ExpireAfter: 24 * time.Hour,
+	})
+	start := time.Date(2024, 3, 27, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	t.Run("Creates the collection as a time series", func(t *testing.T) {
+		if err := readings.EnsureCollection(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		opts := db.CollectionOptions("readings")
+		if opts == nil || opts.TimeSeriesOptions == nil {
+			t.Fatalf("Expected time series options, got %+v", opts)
+		}
+		ts := &options.TimeSeriesOptions{}
+		for _, set := range opts.TimeSeriesOptions.List() {
+			set(ts)
+		}
+		if ts.TimeField != "Time" || ts.MetaField == nil || *ts.MetaField != "Sensor" {
+			t.Errorf("Expected the time field Time and meta field Sensor, got %+v", ts)
+		}
+		if opts.ExpireAfterSeconds == nil || *opts.ExpireAfterSeconds != 86400 {
+			t.Errorf("Expected expiry after a day, got %v", opts.ExpireAfterSeconds)
+		}
+		if err := readings.EnsureCollection(ctx); err != nil {
+			t.Errorf("Expected no error when the collection exists, got %v", err)
+		}
+	})
+	t.Run("Inserts measurements", func(t *testing.T) {
+		_, err := readings.InsertMany([]*Reading{
+			{Sensor: "a", Time: at(0), Value: 1},
+			{Sensor: "a", Time: at(20), Value: 3},
+			{Sensor: "a", Time: at(70), Value: 5},
+			{Sensor: "b", Time: at(10), Value: 10},
+			{Sensor: "b", Time: at(40), Value: 20},
+		}, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if count, _ := readings.Count(bson.M{}, ctx); count != 5 {
+			t.Errorf("Expected 5 readings, got %d", count)
+		}
+	})
+	t.Run("Averages buckets by meta", func(t *testing.T) {
+		buckets, err := readings.BucketAverages("Value", time.Hour, nil, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(buckets) != 3 {
+			t.Fatalf("Expected 3 buckets, got %+v", buckets)
+		}
+		first := buckets[0]
+		if first.Meta != "a" || !first.Start.Equal(start) || first.Average != 2 || first.Min != 1 || first.Max != 3 || first.Count != 2 {
+			t.Errorf("Expected sensor a's first hour to average 2, got %+v", first)
+		}
+		if second := buckets[1]; second.Meta != "b" || second.Average != 15 || second.Count != 2 {
+			t.Errorf("Expected sensor b's first hour to average 15, got %+v", second)
+		}
+		if last := buckets[2]; !last.Start.Equal(at(60)) || last.Average != 5 {
+			t.Errorf("Expected sensor a's second hour to average 5, got %+v", last)
+		}
+		buckets, _ = readings.BucketAverages("Value", 30*time.Minute, bson.M{"Sensor": "b"}, ctx)
+		if len(buckets) != 2 || !buckets[1].Start.Equal(at(30)) {
+			t.Errorf("Expected two half hour buckets for sensor b, got %+v", buckets)
+		}
+	})
+	t.Run("Computes window fields", func(t *testing.T) {
+		results, err := readings.SetWindowFields([]bark.WindowField{
+			{Name: "moving", Operator: "$avg", Field: "Value", Documents: &[2]int{-1, 0}},
+			{Name: "lastHour", Operator: "$sum", Field: "Value", Range: &[2]time.Duration{-time.Hour, 0}},
+			{Name: "count", Operator: "$count"},
+		}, nil, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 5 {
+			t.Fatalf("Expected 5 results, got %d", len(results))
+		}
+		expected := []struct {
+			sensor                  string
+			moving, lastHour, count float64
+		}{
+			{"a", 1, 1, 3},
+			{"a", 2, 4, 3},
+			{"a", 4, 8, 3},
+			{"b", 10, 10, 2},
+			{"b", 15, 30, 2},
+		}
+		for i, want := range expected {
+			got := results[i]
+			if got.Doc.Sensor != want.sensor || got.Fields["moving"] != want.moving || got.Fields["lastHour"] != want.lastHour || got.Fields["count"] != want.count {
+				t.Errorf("Expected %+v at %d, got %s %v", want, i, got.Doc.Sensor, got.Fields)
+			}
+		}
+	})
+	t.Run("Needs a time series", func(t *testing.T) {
+		dogs := bark.NewCollection[*Dog](DogCollectionName)
+		if _, err := dogs.BucketAverages("Age", time.Hour, nil, ctx); !errors.Is(err, bark.ErrNotTimeSeries) {
+			t.Errorf("Expected ErrNotTimeSeries, got %v", err)
+		}
+		if _, err := dogs.SetWindowFields(nil, nil, ctx); !errors.Is(err, bark.ErrNotTimeSeries) {
+			t.Errorf("Expected ErrNotTimeSeries without a sort field, got %v", err)
+		}
+	})
+}
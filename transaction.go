@@ -0,0 +1,130 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrTransactionCommitUnknown = errors.New("transaction commit result is unknown")
+
+// How long WithTransaction keeps retrying transient errors before giving up
+var TransactionRetryTimeout = 120 * time.Second
+
+// How WithTransaction waits between retries of the transaction, and of its commit while the result is unknown
+// MaxAttempts bounds each, the labels are not used, nil turns retries off
+var TransactionRetryPolicy = &RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         1,
+}
+
+const transientTransactionError = "TransientTransactionError"
+const unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+const memoryTransactionKey Key = "memoryTransaction"
+
+// Runs fn inside a transaction on the client behind Db(ctx)
+// Every Collection and Model method called with txCtx takes part in the transaction
+// The whole transaction is retried with backoff while fn or the commit fails with a transient transaction error,
+// see TransactionRetryPolicy and TransactionRetryTimeout
+// If the commit can't be confirmed, the returned error wraps ErrTransactionCommitUnknown
+// If ctx is already in a transaction, fn joins it instead of starting a new one
+func WithTransaction(ctx context.Context, fn func(txCtx context.Context) error, opts ...options.Lister[options.TransactionOptions]) error {
+	if InTransaction(ctx) {
+		return fn(ctx)
+	}
+	// Cached lookups made while the transaction ran may be stale once it commits or rolls back
+	defer invalidateCaches()
+	if memory := memoryDbFrom(ctx); memory != nil && ctx.Value(MockDbErrorKey) == nil {
+		return memoryTransaction(memory, fn, ctx)
+	}
+	db, err := Db(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database for transaction: %w", err)
+	}
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("error starting session: %w", err)
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+	txCtx := mongo.NewSessionContext(ctx, session)
+	deadline := time.Now().Add(TransactionRetryTimeout)
+	for attempt := 1; ; attempt++ {
+		if err := session.StartTransaction(opts...); err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		err := fn(txCtx)
+		if err != nil {
+			session.AbortTransaction(context.WithoutCancel(ctx))
+			if hasErrorLabel(err, transientTransactionError) && retryTransaction(attempt, deadline, ctx) {
+				continue
+			}
+			return err
+		}
+		err = commitTransaction(txCtx, session, deadline)
+		if err != nil && hasErrorLabel(err, transientTransactionError) && retryTransaction(attempt, deadline, ctx) {
+			continue
+		}
+		return err
+	}
+}
+
+// Commits the transaction, retrying while the outcome of the commit is unknown
+func commitTransaction(ctx context.Context, session *mongo.Session, deadline time.Time) error {
+	for attempt := 1; ; attempt++ {
+		err := session.CommitTransaction(ctx)
+		if err == nil {
+			return nil
+		}
+		if !hasErrorLabel(err, unknownTransactionCommitResult) {
+			return fmt.Errorf("error committing transaction: %w", err)
+		}
+		if !retryTransaction(attempt, deadline, ctx) {
+			return fmt.Errorf("%w: %w", ErrTransactionCommitUnknown, err)
+		}
+	}
+}
+
+// Waits out the backoff before another attempt and returns true,
+// or returns false once the attempts are used up, the deadline has passed or ctx is done
+func retryTransaction(attempt int, deadline time.Time, ctx context.Context) bool {
+	policy := TransactionRetryPolicy
+	if policy == nil || attempt >= policy.MaxAttempts || time.Now().After(deadline) {
+		return false
+	}
+	return policy.wait(attempt, ctx) == nil
+}
+
+// Runs fn against the in-memory database, putting every collection back the way it was if fn fails
+// Operations outside the transaction wait until it is done, so rolling back only undoes fn's writes
+func memoryTransaction(memory *MemoryDb, fn func(txCtx context.Context) error, ctx context.Context) error {
+	memory.tx.Lock()
+	defer memory.tx.Unlock()
+	snapshot := memory.snapshot()
+	if err := fn(context.WithValue(ctx, memoryTransactionKey, memory)); err != nil {
+		memory.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// Returns true if ctx carries a session with a transaction in progress
+func InTransaction(ctx context.Context) bool {
+	if memory, ok := ctx.Value(memoryTransactionKey).(*MemoryDb); ok && memory != nil {
+		return true
+	}
+	session := mongo.SessionFromContext(ctx)
+	return session != nil && session.ClientSession().TransactionRunning()
+}
+
+// Returns true if the error or anything it wraps carries the given server error label
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
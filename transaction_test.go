@@ -0,0 +1,115 @@
+package bark_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Skips the test unless the database is a replica set, which transactions and change streams need
+// Start one locally with ./start_test_rs.sh
+func requireReplicaSet(ctx context.Context, t *testing.T) {
+	db, err := bark.Db(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	var hello bson.M
+	if err := db.RunCommand(ctx, bson.M{"hello": 1}).Decode(&hello); err != nil {
+		t.Fatalf("Failed to run hello: %v", err)
+	}
+	if _, ok := hello["setName"]; !ok {
+		t.Skip("database is not a replica set")
+	}
+}
+func TestInTransaction(t *testing.T) {
+	if bark.InTransaction(context.Background()) {
+		t.Error("Expected plain context not to be in a transaction")
+	}
+}
+func TestWithTransaction(t *testing.T) {
+	ctx := setupTest("WithTransaction", "2024-03-27T19:55:38.782Z", t)
+
+	t.Run("Fails when the database is unavailable", func(t *testing.T) {
+		called := false
+		mockCtx := context.WithValue(ctx, bark.MockDbErrorKey, "Mocked error")
+		err := bark.WithTransaction(mockCtx, func(txCtx context.Context) error {
+			called = true
+			return nil
+		})
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if called {
+			t.Error("Expected callback not to be called")
+		}
+	})
+
+	requireReplicaSet(ctx, t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+
+	t.Run("Commits all writes", func(t *testing.T) {
+		err := bark.WithTransaction(ctx, func(txCtx context.Context) error {
+			if !bark.InTransaction(txCtx) {
+				t.Error("Expected callback context to be in a transaction")
+			}
+			if _, err := NewDog("Spot").Save(txCtx); err != nil {
+				return err
+			}
+			_, err := dogs.DeleteOne(bson.M{"Id": "1111"}, txCtx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := dogs.Count(bson.M{}, ctx)
+		if count != 1 {
+			t.Errorf("Expected 1 dog after commit, got %d", count)
+		}
+	})
+
+	t.Run("Rolls back when the callback fails", func(t *testing.T) {
+		SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}}, ctx)
+		failure := errors.New("failure")
+		err := bark.WithTransaction(ctx, func(txCtx context.Context) error {
+			if _, err := NewDog("Spot").Save(txCtx); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Expected callback error, got %v", err)
+		}
+		count, _ := dogs.Count(bson.M{}, ctx)
+		if count != 1 {
+			t.Errorf("Expected 1 dog after rollback, got %d", count)
+		}
+	})
+
+	t.Run("Nested transactions join the outer one", func(t *testing.T) {
+		SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}}, ctx)
+		failure := errors.New("failure")
+		err := bark.WithTransaction(ctx, func(txCtx context.Context) error {
+			err := bark.WithTransaction(txCtx, func(innerCtx context.Context) error {
+				_, err := NewDog("Spot").Save(innerCtx)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Expected callback error, got %v", err)
+		}
+		count, _ := dogs.Count(bson.M{}, ctx)
+		if count != 1 {
+			t.Errorf("Expected inner write to be rolled back, got %d dogs", count)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package bark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrMissingUpgrade = errors.New("no upgrade registered for schema version")
+
+// Upgrades a raw document from one schema version to the next
+type UpgradeFunc func(doc bson.M) (bson.M, error)
+
+// Sets the current schema version for documents in the collection
+// Documents saved through SaveModel are stamped with this version
+func (c *Collection[T]) SetSchemaVersion(version int) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.schemaVersion = version
+	return c
+}
+
+// Returns the current schema version for documents in the collection
+// This is the version set with SetSchemaVersion or one past the newest registered upgrade, whichever is higher
+func (c *Collection[T]) SchemaVersion() int {
+	return configFor(c.Name).currentSchemaVersion()
+}
+
+// Registers a function that upgrades documents from the given version to the next one
+// Documents without a SchemaVersion are treated as version 0
+func (c *Collection[T]) RegisterUpgrade(from int, fn UpgradeFunc) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.upgrades[from] = fn
+	return c
+}
+
+// Enables or disables saving upgraded documents back to the database when they are read
+func (c *Collection[T]) WriteBackUpgrades(enabled bool) *Collection[T] {
+	cfg := configFor(c.Name)
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.writeBackUpgrades = enabled
+	return c
+}
+
+// Returns the schema version new and upgraded documents should carry
+func (cfg *collectionConfig) currentSchemaVersion() int {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	version := cfg.schemaVersion
+	for from := range cfg.upgrades {
+		if from+1 > version {
+			version = from + 1
+		}
+	}
+	return version
+}
+
+// Runs the registered upgrades on the document until it reaches the current schema version
+// Returns the original document and false if no upgrade was needed
+func (cfg *collectionConfig) upgrade(doc bson.M) (bson.M, bool, error) {
+	current := cfg.currentSchemaVersion()
+	version := schemaVersionOf(doc)
+	if version >= current {
+		return doc, false, nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	for version < current {
+		fn, ok := cfg.upgrades[version]
+		if !ok {
+			return doc, false, fmt.Errorf("%w %d", ErrMissingUpgrade, version)
+		}
+		upgraded, err := fn(doc)
+		if err != nil {
+			return doc, false, fmt.Errorf("error upgrading document from schema version %d: %w", version, err)
+		}
+		doc = upgraded
+		version++
+	}
+	doc["SchemaVersion"] = version
+	return doc, true, nil
+}
+
+// Reads the schema version from a raw document, treating a missing version as 0
+func schemaVersionOf(doc bson.M) int {
+	switch v := doc["SchemaVersion"].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// Decodes a raw document into obj, upgrading it first if it is behind the current schema version
+// Upgrades are written back to the backend if enabled, pass nil when raw isn't the whole stored document
+func (c *Collection[T]) decode(backend Backend, raw bson.Raw, obj *T, ctx context.Context) error {
+	_, err := decodeUpgraded(c.Name, backend, raw, obj, ctx)
+	return err
+}
+
+// Decodes a raw document from the named collection into obj, upgrading it first if it is behind the collection's schema version
+// Returns the document that was decoded, which is the upgraded one if it was upgraded
+// Upgrades are written back to the backend if enabled, pass nil when raw isn't the whole stored document
+func decodeUpgraded(collection string, backend Backend, raw bson.Raw, obj any, ctx context.Context) (bson.Raw, error) {
+	cfg := configFor(collection)
+	if cfg.currentSchemaVersion() == 0 {
+		return raw, bson.Unmarshal(raw, obj)
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	previous := schemaVersionOf(doc)
+	doc, upgraded, err := cfg.upgrade(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !upgraded {
+		return raw, bson.Unmarshal(raw, obj)
+	}
+	bsonBytes, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal upgraded document: %w", err)
+	}
+	if err := bson.Unmarshal(bsonBytes, obj); err != nil {
+		return nil, err
+	}
+	cfg.mu.RLock()
+	writeBack := cfg.writeBackUpgrades
+	cfg.mu.RUnlock()
+	if writeBack && backend != nil {
+		// A failed write back shouldn't fail the read, the document will be upgraded again next time
+		if err := writeBackUpgrade(backend, doc, previous, ctx); err != nil {
+			Logger().WarnContext(ctx, "failed to write back upgraded document", "collection", collection, "id", doc["_id"], "error", err)
+		}
+	}
+	return bsonBytes, nil
+}
+
+// Returns the backend to write upgrades back to, nil if the find is projected since its documents are incomplete
+// and replacing the stored documents with them would lose the other fields
+func writeBackBackend(backend Backend, opts *options.FindOptionsBuilder) Backend {
+	findOpts, err := resolveOptions[options.FindOptions](opts)
+	if err != nil || findOpts.Projection != nil {
+		return nil
+	}
+	return backend
+}
+
+// Replaces the stored document with its upgraded version
+// The filter includes the previous version so concurrent upgrades don't overwrite each other
+func writeBackUpgrade(backend Backend, doc bson.M, previous int, ctx context.Context) error {
+	filter := bson.M{"_id": doc["_id"]}
+	if previous == 0 {
+		filter["SchemaVersion"] = bson.M{"$exists": false}
+	} else {
+		filter["SchemaVersion"] = previous
+	}
+	_, err := backend.ReplaceOne(ctx, filter, doc, nil)
+	return err
+}
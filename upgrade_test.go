@@ -0,0 +1,173 @@
+package bark_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Registers upgrades that rename Title to Name and then double the Age
+func setupUpgradedDogs(name string) *bark.Collection[*Dog] {
+	dogs := bark.NewCollection[*Dog](name)
+	dogs.RegisterUpgrade(0, func(doc bson.M) (bson.M, error) {
+		doc["Name"] = doc["Title"]
+		delete(doc, "Title")
+		return doc, nil
+	})
+	dogs.RegisterUpgrade(1, func(doc bson.M) (bson.M, error) {
+		if age, ok := doc["Age"].(int32); ok {
+			doc["Age"] = age * 2
+		}
+		return doc, nil
+	})
+	return dogs
+}
+func TestSchemaVersion(t *testing.T) {
+	t.Run("Defaults to zero", func(t *testing.T) {
+		dogs := bark.NewCollection[*Dog]("unversioned_dogs")
+		if dogs.SchemaVersion() != 0 {
+			t.Errorf("Expected schema version 0, got %d", dogs.SchemaVersion())
+		}
+	})
+	t.Run("Is one past the newest upgrade", func(t *testing.T) {
+		dogs := setupUpgradedDogs("versioned_dogs")
+		if dogs.SchemaVersion() != 2 {
+			t.Errorf("Expected schema version 2, got %d", dogs.SchemaVersion())
+		}
+	})
+	t.Run("Explicit version wins when higher", func(t *testing.T) {
+		dogs := bark.NewCollection[*Dog]("explicit_dogs").SetSchemaVersion(5)
+		if dogs.SchemaVersion() != 5 {
+			t.Errorf("Expected schema version 5, got %d", dogs.SchemaVersion())
+		}
+	})
+	t.Run("Is shared by collections with the same name", func(t *testing.T) {
+		setupUpgradedDogs("shared_dogs")
+		other := bark.NewCollection[*Dog]("shared_dogs")
+		if other.SchemaVersion() != 2 {
+			t.Errorf("Expected schema version 2, got %d", other.SchemaVersion())
+		}
+	})
+}
+func TestUpgradeOnRead(t *testing.T) {
+	ctx := setupTest("UpgradeOnRead", "2024-03-27T19:55:38.782Z", t)
+	dogs := setupUpgradedDogs("upgraded_dogs")
+	collection, err := dogs.Backend(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get collection: %v", err)
+	}
+	reset := func() {
+		collection.DeleteMany(ctx, bson.M{})
+		collection.InsertMany(ctx, []any{
+			bson.M{"_id": "1111", "Id": "1111", "Title": "Fido", "Age": 3},
+			bson.M{"_id": "2222", "Id": "2222", "Name": "Spot", "Age": 5, "SchemaVersion": 1},
+			bson.M{"_id": "3333", "Id": "3333", "Name": "Rex", "Age": 7, "SchemaVersion": 2},
+		})
+	}
+
+	t.Run("FindOne upgrades old documents", func(t *testing.T) {
+		reset()
+		dog, err := dogs.Get("1111", ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if dog.Name != "Fido" || dog.Age != 6 || dog.SchemaVersion != 2 {
+			t.Errorf("Expected upgraded Fido, got %s", dog.String())
+		}
+	})
+
+	t.Run("Find upgrades from any older version", func(t *testing.T) {
+		reset()
+		results, err := dogs.Find(bson.M{}, nil, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ages := map[string]int{}
+		for _, dog := range results {
+			ages[dog.Name] = dog.Age
+		}
+		if ages["Fido"] != 6 || ages["Spot"] != 10 || ages["Rex"] != 7 {
+			t.Errorf("Expected ages 6, 10 and 7, got %v", ages)
+		}
+	})
+
+	t.Run("Leaves stored documents alone by default", func(t *testing.T) {
+		reset()
+		dogs.WriteBackUpgrades(false)
+		if _, err := dogs.Get("1111", ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := collection.CountDocuments(ctx, bson.M{"Title": "Fido"})
+		if count != 1 {
+			t.Errorf("Expected stored document to be unchanged")
+		}
+	})
+
+	t.Run("Writes back upgraded documents when enabled", func(t *testing.T) {
+		reset()
+		dogs.WriteBackUpgrades(true)
+		defer dogs.WriteBackUpgrades(false)
+		if _, err := dogs.Get("1111", ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := collection.CountDocuments(ctx, bson.M{"Name": "Fido", "Age": 6, "SchemaVersion": 2})
+		if count != 1 {
+			t.Errorf("Expected stored document to be upgraded")
+		}
+	})
+
+	t.Run("Fails when an upgrade is missing", func(t *testing.T) {
+		gappy := bark.NewCollection[*Dog]("upgraded_dogs_gap")
+		gappy.RegisterUpgrade(1, func(doc bson.M) (bson.M, error) { return doc, nil })
+		gapCollection, _ := gappy.Backend(ctx)
+		gapCollection.DeleteMany(ctx, bson.M{})
+		gapCollection.InsertOne(ctx, bson.M{"_id": "1111", "Id": "1111", "Name": "Fido"})
+		_, err := gappy.Get("1111", ctx)
+		if !errors.Is(err, bark.ErrMissingUpgrade) {
+			t.Errorf("Expected ErrMissingUpgrade, got %v", err)
+		}
+	})
+
+	t.Run("SaveModel stamps the current schema version", func(t *testing.T) {
+		reset()
+		fido := NewDog("Fido")
+		fido.CollectionName = "upgraded_dogs"
+		fido.Id = "4444"
+		if _, err := fido.Save(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := collection.CountDocuments(ctx, bson.M{"Id": "4444", "SchemaVersion": 2})
+		if count != 1 {
+			t.Errorf("Expected saved document to carry schema version 2")
+		}
+	})
+}
+
+func TestWriteBackProjected(t *testing.T) {
+	ctx := setupMemoryTest("WriteBackProjected", "2024-03-27T19:55:38.782Z", t)
+	dogs := setupUpgradedDogs("projected_dogs").WriteBackUpgrades(true)
+	collection, _ := dogs.Backend(ctx)
+	collection.InsertOne(ctx, bson.M{"_id": "1111", "Id": "1111", "Title": "Fido", "Age": int32(3)})
+
+	t.Run("Leaves documents read with a projection alone", func(t *testing.T) {
+		if _, err := dogs.Find(bson.M{}, options.Find().SetProjection(bson.M{"Title": 1}), ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := collection.CountDocuments(ctx, bson.M{"Id": "1111", "Title": "Fido", "Age": 3, "SchemaVersion": bson.M{"$exists": false}})
+		if count != 1 {
+			t.Errorf("Expected the stored document to be unchanged")
+		}
+	})
+	t.Run("Writes back documents read in full", func(t *testing.T) {
+		if _, err := dogs.Find(bson.M{}, nil, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		count, _ := collection.CountDocuments(ctx, bson.M{"Id": "1111", "Name": "Fido", "Age": 6, "SchemaVersion": 2})
+		if count != 1 {
+			t.Errorf("Expected the stored document to be upgraded")
+		}
+	})
+}
@@ -4,16 +4,18 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"os"
+	"sync/atomic"
 )
 
 const tokenLength = 16
 
-var last_test_uuid = 0
+var lastTestUuid atomic.Int64
 
-func resetTestUuid() {
-	last_test_uuid = 0
+// Restarts the sequential ids Uuid gives in test mode
+// Prefer a SequentialIDGenerator set with WithIDGenerator for tests that run in parallel
+func ResetTestUuid() {
+	lastTestUuid.Store(0)
 }
 
 // Uuid generates a random UUID string.
@@ -26,11 +28,9 @@ func Uuid(length ...int) string {
 		l = length[0]
 	}
 	if env == "test" {
-		last_test_uuid += 1
-		uuid := fmt.Sprintf("%0*d", l, last_test_uuid)
+		uuid := fmt.Sprintf("%0*d", l, lastTestUuid.Add(1))
 		return uuid
 	}
-	log.Println("Generating UUID in production mode of length", l)
 	b := make([]byte, l/2) // Divide by 2 because hex encoding doubles the length
 	if _, err := rand.Read(b); err != nil {
 		return ""
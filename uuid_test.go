@@ -8,7 +8,7 @@ import (
 
 func TestUuidInTestEnv(t *testing.T) {
 	// Set the environment to "test"
-	resetTestUuid()
+	ResetTestUuid()
 	os.Setenv("ENV", "test")
 	defer os.Unsetenv("ENV")
 
@@ -46,7 +46,7 @@ func TestUuidWithLength(t *testing.T) {
 	// Set the environment to "test"
 	os.Setenv("ENV", "test")
 	defer os.Unsetenv("ENV")
-	resetTestUuid()
+	ResetTestUuid()
 	testLen := 8
 	uuid := Uuid(testLen)
 	if uuid != "00000001" {
@@ -0,0 +1,148 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var projectionsCache sync.Map
+
+// Returns the projection that fetches only the fields of the view type
+// Fields come from the view's bson tags, inlined structs are included field by field and fields tagged "-" are left out
+func ProjectionFor[V any]() bson.D {
+	t := reflect.TypeFor[V]()
+	if cached, ok := projectionsCache.Load(t); ok {
+		return cached.(bson.D)
+	}
+	projection := bson.D{}
+	seen := make(map[string]bool)
+	addProjectionFields(t, &projection, seen)
+	// The _id is included unless excluded, so it is excluded when the view doesn't have it
+	if !seen["_id"] {
+		projection = append(projection, bson.E{Key: "_id", Value: 0})
+	}
+	projectionsCache.Store(t, projection)
+	return projection
+}
+
+// Adds the keys of the struct's fields to the projection
+func addProjectionFields(t reflect.Type, projection *bson.D, seen map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+		_, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(","+opts+",", ",inline,") {
+			addProjectionFields(field.Type, projection, seen)
+			continue
+		}
+		if key := bsonKey(field); !seen[key] {
+			seen[key] = true
+			*projection = append(*projection, bson.E{Key: key, Value: 1})
+		}
+	}
+}
+
+// Returns the options with the view's projection, unless they already have a projection
+// The caller's builder is left as it was
+func withViewProjection[V any](opts *options.FindOptionsBuilder) (*options.FindOptionsBuilder, error) {
+	builder := options.Find()
+	if opts != nil {
+		builder.Opts = append(builder.Opts, opts.Opts...)
+	}
+	resolved, err := resolveOptions[options.FindOptions](builder)
+	if err != nil {
+		return nil, err
+	}
+	if resolved.Projection == nil {
+		builder.SetProjection(ProjectionFor[V]())
+	}
+	return builder, nil
+}
+
+// Finds the documents matching the filter in the collection and decodes them into the view type
+// Only the view's fields are fetched, see ProjectionFor
+// Views are decoded as stored, so schema upgrades and population don't apply to them
+func FindAs[V any, T ModelWithCollection](c *Collection[T], filter bson.M, opts *options.FindOptionsBuilder, ctx context.Context) ([]V, error) {
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to find in: %w", err)
+	}
+	opts, err = withViewProjection[V](opts)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := backend.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+	var results []V
+	for cursor.Next(ctx) {
+		view, err := decodeView[V](cursor.Current(), c.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding document: %w", err)
+		}
+		results = append(results, view)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error decoding documents: %w", err)
+	}
+	return results, nil
+}
+
+// Finds a single document matching the filter and decodes it into the view type
+// Returns ErrNotFound if nothing matches
+func FindOneAs[V any, T ModelWithCollection](c *Collection[T], filter bson.M, ctx context.Context) (V, error) {
+	backend, err := c.Backend(ctx)
+	if err != nil {
+		return *new(V), fmt.Errorf("failed to get collection to find in: %w", err)
+	}
+	raw, err := backend.FindOne(ctx, filter, options.FindOne().SetProjection(ProjectionFor[V]()))
+	if err == mongo.ErrNoDocuments {
+		return *new(V), ErrNotFound
+	}
+	if err != nil {
+		return *new(V), fmt.Errorf("error fetching documents: %w", err)
+	}
+	view, err := decodeView[V](raw, c.Name)
+	if err != nil {
+		return *new(V), fmt.Errorf("error decoding document: %w", err)
+	}
+	return view, nil
+}
+
+// Decodes a document into the view type, allocating it if the view is a pointer
+func decodeView[V any](raw bson.Raw, collection string) (V, error) {
+	var view V
+	if t := reflect.TypeFor[V](); t.Kind() == reflect.Pointer {
+		view = reflect.New(t.Elem()).Interface().(V)
+		if err := bson.Unmarshal(raw, view); err != nil {
+			return *new(V), err
+		}
+	} else if err := bson.Unmarshal(raw, &view); err != nil {
+		return *new(V), err
+	}
+	if model, ok := any(view).(ModelWithCollection); ok {
+		model.SetCollectionName(collection)
+	}
+	return view, nil
+}
@@ -0,0 +1,81 @@
+package bark_test
+
+import (
+	"testing"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type DogSummary struct {
+	Id   string `bson:"Id"`
+	Name string `bson:"Name"`
+}
+
+type DogListItem struct {
+	bark.Model `bson:",inline"`
+	Name       string `bson:"Name"`
+	Ignored    string `bson:"-"`
+}
+
+func TestProjectionFor(t *testing.T) {
+	projection := bark.ProjectionFor[DogSummary]()
+	expected := bson.D{{Key: "Id", Value: 1}, {Key: "Name", Value: 1}, {Key: "_id", Value: 0}}
+	if len(projection) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, projection)
+	}
+	for i := range expected {
+		if projection[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, projection)
+		}
+	}
+	keys := map[string]bool{}
+	for _, elem := range bark.ProjectionFor[*DogListItem]() {
+		keys[elem.Key] = true
+	}
+	if !keys["_id"] || !keys["Id"] || !keys["Version"] || !keys["Name"] || keys["Ignored"] || keys["Age"] {
+		t.Errorf("Expected the inlined model fields and Name, got %v", keys)
+	}
+}
+
+func TestFindAs(t *testing.T) {
+	ctx := setupMemoryTest("FindAs", "2024-03-27T19:55:38.782Z", t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}, {Name: "Spot", Id: "2222", Age: 5}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	t.Run("Fetches only the view's fields", func(t *testing.T) {
+		opts := options.Find().SetSort(bson.M{"Name": -1})
+		summaries, err := bark.FindAs[DogSummary](dogs, bson.M{}, opts, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(summaries) != 2 || summaries[0] != (DogSummary{Id: "2222", Name: "Spot"}) {
+			t.Errorf("Expected Spot first, got %v", summaries)
+		}
+		items, err := bark.FindAs[*DogListItem](dogs, bson.M{"Age": 3}, nil, ctx)
+		if err != nil || len(items) != 1 {
+			t.Fatalf("Expected one item, got %v and %v", items, err)
+		}
+		if items[0].Name != "Fido" || items[0].Version != 1 || items[0].GetCollectionName() != DogCollectionName {
+			t.Errorf("Expected Fido with its model fields, got %+v", items[0])
+		}
+	})
+	t.Run("Keeps an explicit projection", func(t *testing.T) {
+		opts := options.Find().SetProjection(bson.M{"Name": 1})
+		summaries, err := bark.FindAs[DogSummary](dogs, bson.M{"Id": "1111"}, opts, ctx)
+		if err != nil || len(summaries) != 1 || summaries[0] != (DogSummary{Name: "Fido"}) {
+			t.Errorf("Expected only the name, got %v and %v", summaries, err)
+		}
+	})
+	t.Run("FindOneAs", func(t *testing.T) {
+		summary, err := bark.FindOneAs[DogSummary](dogs, bson.M{"Id": "2222"}, ctx)
+		if err != nil || summary.Name != "Spot" {
+			t.Errorf("Expected Spot, got %v and %v", summary, err)
+		}
+		if _, err := bark.FindOneAs[DogSummary](dogs, bson.M{"Id": "9999"}, ctx); err != bark.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}
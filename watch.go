@@ -0,0 +1,260 @@
+package bark
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// The kind of change reported by a change stream
+type OperationType string
+
+const (
+	OperationInsert     OperationType = "insert"
+	OperationUpdate     OperationType = "update"
+	OperationReplace    OperationType = "replace"
+	OperationDelete     OperationType = "delete"
+	OperationDrop       OperationType = "drop"
+	OperationInvalidate OperationType = "invalidate"
+)
+
+// Describes the fields changed by an update
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// A single change to a document in a watched collection
+// FullDocument is only set for inserts and replaces, and for updates when WatchOptions.FullDocument is set
+type ChangeEvent[T ModelWithCollection] struct {
+	OperationType     OperationType
+	FullDocument      T
+	UpdateDescription *UpdateDescription
+	DocumentKey       bson.M
+	ClusterTime       bson.Timestamp
+	ResumeToken       bson.Raw
+}
+
+// The raw shape of a change event before the full document is decoded into T
+type rawChangeEvent struct {
+	ResumeToken       bson.Raw           `bson:"_id"`
+	OperationType     OperationType      `bson:"operationType"`
+	FullDocument      bson.Raw           `bson:"fullDocument"`
+	UpdateDescription *UpdateDescription `bson:"updateDescription"`
+	DocumentKey       bson.M             `bson:"documentKey"`
+	ClusterTime       bson.Timestamp     `bson:"clusterTime"`
+}
+
+// Persists the position of a change stream so it can resume after a restart
+type ResumeTokenStore interface {
+	// Returns the last saved token for the named stream, or nil if there isn't one
+	LoadResumeToken(name string, ctx context.Context) (bson.Raw, error)
+	// Saves the token for the named stream
+	SaveResumeToken(name string, token bson.Raw, ctx context.Context) error
+}
+
+// Options for watching a collection
+type WatchOptions struct {
+	// Identifies the stream in the resume token store, required when Store is set
+	Name string
+	// Where to load and save resume tokens, nil to always start from now
+	Store ResumeTokenStore
+	// Looks up the current version of the document for update events
+	FullDocument bool
+	// Maximum number of events to fetch per batch, 0 for the server default
+	BatchSize int32
+}
+
+// A typed stream of changes to a collection
+type ChangeStream[T ModelWithCollection] struct {
+	collection *Collection[T]
+	stream     *mongo.ChangeStream
+	opts       WatchOptions
+	event      ChangeEvent[T]
+	unsaved    bson.Raw
+	err        error
+}
+
+// Opens a change stream on the collection
+// The filter is matched against change events, e.g. bson.M{"operationType": "insert"}
+// When a resume token store is set the stream continues after the last event it saved
+func (c *Collection[T]) Watch(filter bson.M, opts *WatchOptions, ctx context.Context) (*ChangeStream[T], error) {
+	if memoryDbFrom(ctx) != nil {
+		return nil, fmt.Errorf("%w: change streams", ErrNotSupportedInMemory)
+	}
+	collection, err := c.MongoCollection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection to watch: %w", err)
+	}
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	if opts.Store != nil && opts.Name == "" {
+		return nil, fmt.Errorf("a name is required to store resume tokens")
+	}
+	pipeline := mongo.Pipeline{}
+	if len(filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+	streamOpts := options.ChangeStream()
+	if opts.FullDocument {
+		streamOpts.SetFullDocument(options.UpdateLookup)
+	}
+	if opts.BatchSize > 0 {
+		streamOpts.SetBatchSize(opts.BatchSize)
+	}
+	if opts.Store != nil {
+		token, err := opts.Store.LoadResumeToken(opts.Name, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error loading resume token: %w", err)
+		}
+		if token != nil {
+			streamOpts.SetStartAfter(token)
+		}
+	}
+	stream, err := collection.Watch(ctx, pipeline, streamOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error opening change stream: %w", err)
+	}
+	return &ChangeStream[T]{collection: c, stream: stream, opts: *opts}, nil
+}
+
+// Waits for the next event and returns true once it is available from Event
+// Calling Next marks the previous event as handled and saves its resume token
+func (s *ChangeStream[T]) Next(ctx context.Context) bool {
+	if s.err != nil {
+		return false
+	}
+	if s.err = s.saveResumeToken(ctx); s.err != nil {
+		return false
+	}
+	if !s.stream.Next(ctx) {
+		s.err = s.stream.Err()
+		return false
+	}
+	var raw rawChangeEvent
+	if err := s.stream.Decode(&raw); err != nil {
+		s.err = fmt.Errorf("error decoding change event: %w", err)
+		return false
+	}
+	event := ChangeEvent[T]{
+		OperationType:     raw.OperationType,
+		UpdateDescription: raw.UpdateDescription,
+		DocumentKey:       raw.DocumentKey,
+		ClusterTime:       raw.ClusterTime,
+		ResumeToken:       raw.ResumeToken,
+	}
+	if len(raw.FullDocument) > 0 {
+		// Not written back, the document may have changed since the event
+		if err := s.collection.decode(nil, raw.FullDocument, &event.FullDocument, ctx); err != nil {
+			s.err = fmt.Errorf("error decoding change event document: %w", err)
+			return false
+		}
+		event.FullDocument.SetCollectionName(s.collection.Name)
+	}
+	s.event = event
+	s.unsaved = raw.ResumeToken
+	return true
+}
+
+// Returns the current event
+func (s *ChangeStream[T]) Event() ChangeEvent[T] {
+	return s.event
+}
+
+// Returns the error that stopped the stream, if any
+func (s *ChangeStream[T]) Err() error {
+	return s.err
+}
+
+// Saves the resume token of the current event and closes the stream
+func (s *ChangeStream[T]) Close(ctx context.Context) error {
+	saveErr := s.saveResumeToken(ctx)
+	if err := s.stream.Close(ctx); err != nil {
+		return fmt.Errorf("error closing change stream: %w", err)
+	}
+	return saveErr
+}
+
+// Saves the resume token of the last event returned by Next, if it hasn't been saved yet
+func (s *ChangeStream[T]) saveResumeToken(ctx context.Context) error {
+	if s.opts.Store == nil || s.unsaved == nil {
+		return nil
+	}
+	if err := s.opts.Store.SaveResumeToken(s.opts.Name, s.unsaved, ctx); err != nil {
+		return fmt.Errorf("error saving resume token: %w", err)
+	}
+	s.unsaved = nil
+	return nil
+}
+
+// Keeps resume tokens in memory, useful for tests and short lived processes
+type MemoryResumeTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+// Creates a new in-memory resume token store
+func NewMemoryResumeTokenStore() *MemoryResumeTokenStore {
+	return &MemoryResumeTokenStore{tokens: make(map[string]bson.Raw)}
+}
+
+// Returns the last saved token for the named stream
+func (s *MemoryResumeTokenStore) LoadResumeToken(name string, ctx context.Context) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[name], nil
+}
+
+// Saves the token for the named stream
+func (s *MemoryResumeTokenStore) SaveResumeToken(name string, token bson.Raw, ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[name] = token
+	return nil
+}
+
+// Keeps resume tokens in a collection of the database in the context
+type CollectionResumeTokenStore struct {
+	CollectionName string
+}
+
+// Creates a resume token store backed by the named collection
+func NewCollectionResumeTokenStore(collectionName string) *CollectionResumeTokenStore {
+	return &CollectionResumeTokenStore{CollectionName: collectionName}
+}
+
+// Returns the last saved token for the named stream
+func (s *CollectionResumeTokenStore) LoadResumeToken(name string, ctx context.Context) (bson.Raw, error) {
+	db, err := Db(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database to load resume token: %w", err)
+	}
+	var doc struct {
+		Token bson.Raw `bson:"Token"`
+	}
+	err = db.Collection(s.CollectionName).FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+// Saves the token for the named stream
+func (s *CollectionResumeTokenStore) SaveResumeToken(name string, token bson.Raw, ctx context.Context) error {
+	db, err := Db(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database to save resume token: %w", err)
+	}
+	update := bson.M{"$set": bson.M{"Token": token, "UpdatedOn": Now(ctx)}}
+	opts := options.UpdateOne().SetUpsert(true)
+	_, err = db.Collection(s.CollectionName).UpdateOne(ctx, bson.M{"_id": name}, update, opts)
+	return err
+}
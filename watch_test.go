@@ -0,0 +1,120 @@
+package bark_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jaredtmartin/bark-go-mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMemoryResumeTokenStore(t *testing.T) {
+	ctx := context.Background()
+	store := bark.NewMemoryResumeTokenStore()
+
+	token, err := store.LoadResumeToken("dogs", ctx)
+	if err != nil || token != nil {
+		t.Errorf("Expected no token and no error, got %v and %v", token, err)
+	}
+	saved, _ := bson.Marshal(bson.M{"_data": "abc"})
+	if err := store.SaveResumeToken("dogs", saved, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	token, _ = store.LoadResumeToken("dogs", ctx)
+	if string(token) != string(saved) {
+		t.Errorf("Expected saved token, got %v", token)
+	}
+	token, _ = store.LoadResumeToken("cats", ctx)
+	if token != nil {
+		t.Errorf("Expected tokens to be kept per stream, got %v", token)
+	}
+}
+func TestWatch(t *testing.T) {
+	ctx := setupTest("Watch", "2024-03-27T19:55:38.782Z", t)
+
+	t.Run("Requires a name when storing resume tokens", func(t *testing.T) {
+		dogs := bark.NewCollection[*Dog]("dogs")
+		_, err := dogs.Watch(nil, &bark.WatchOptions{Store: bark.NewMemoryResumeTokenStore()}, ctx)
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+
+	requireReplicaSet(ctx, t)
+	dogs, err := SetupFixture([]*Obj{{Name: "Fido", Id: "1111", Age: 3}}, ctx)
+	if err != nil {
+		t.Fatalf("Failed to setup fixture: %v", err)
+	}
+	store := bark.NewMemoryResumeTokenStore()
+	opts := &bark.WatchOptions{Name: "dogs-test", Store: store, FullDocument: true}
+	nextEvent := func(stream *bark.ChangeStream[*Dog]) bark.ChangeEvent[*Dog] {
+		waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if !stream.Next(waitCtx) {
+			t.Fatalf("Expected an event, got error %v", stream.Err())
+		}
+		return stream.Event()
+	}
+
+	t.Run("Reports typed inserts and updates", func(t *testing.T) {
+		stream, err := dogs.Watch(nil, opts, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		spot := NewDog("Spot")
+		spot.Id = "2222"
+		spot.Save(ctx)
+		spot.Age = 4
+		spot.Save(ctx)
+
+		event := nextEvent(stream)
+		if event.OperationType != bark.OperationInsert || event.FullDocument.Name != "Spot" {
+			t.Errorf("Expected insert of Spot, got %s of %v", event.OperationType, event.FullDocument)
+		}
+		if event.FullDocument.CollectionName != "dogs" {
+			t.Errorf("Expected collection name 'dogs', got %s", event.FullDocument.CollectionName)
+		}
+		event = nextEvent(stream)
+		if event.OperationType != bark.OperationUpdate || event.FullDocument.Age != 4 {
+			t.Errorf("Expected update of Spot's age, got %s of %v", event.OperationType, event.FullDocument)
+		}
+		if event.UpdateDescription == nil || event.UpdateDescription.UpdatedFields["Age"] == nil {
+			t.Errorf("Expected Age in the update description, got %v", event.UpdateDescription)
+		}
+		if err := stream.Close(ctx); err != nil {
+			t.Fatalf("Expected no error closing, got %v", err)
+		}
+	})
+
+	t.Run("Resumes after the last handled event", func(t *testing.T) {
+		rex := NewDog("Rex")
+		rex.Save(ctx)
+		stream, err := dogs.Watch(nil, opts, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer stream.Close(ctx)
+		event := nextEvent(stream)
+		if event.OperationType != bark.OperationInsert || event.FullDocument.Name != "Rex" {
+			t.Errorf("Expected insert of Rex, got %s of %v", event.OperationType, event.FullDocument)
+		}
+	})
+
+	t.Run("Filters events", func(t *testing.T) {
+		stream, err := dogs.Watch(bson.M{"operationType": "delete"}, nil, ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer stream.Close(ctx)
+		NewDog("Max").Save(ctx)
+		dogs.DeleteOne(bson.M{"Id": "1111"}, ctx)
+		event := nextEvent(stream)
+		if event.OperationType != bark.OperationDelete {
+			t.Errorf("Expected delete, got %s", event.OperationType)
+		}
+		if event.DocumentKey["_id"] != "1111" {
+			t.Errorf("Expected document key 1111, got %v", event.DocumentKey)
+		}
+	})
+}